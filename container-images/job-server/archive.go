@@ -0,0 +1,170 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"greengrader/webserver/gradescope"
+)
+
+// ArchivePolicy limits what a submission archive may contain. It is checked
+// in /submit, before anything is sent to the cluster.
+type ArchivePolicy struct {
+	// MaxBytes caps the total uncompressed size (default 50MiB).
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	// MaxEntries caps the number of files and directories (default 2000).
+	MaxEntries int `json:"max_entries,omitempty"`
+	// Required lists globs (see globMatch) that must each match at least one
+	// entry, e.g. "*PA2/Makefile".
+	Required []string `json:"required,omitempty"`
+	// Forbidden lists globs no entry may match, e.g. "*.o".
+	Forbidden []string `json:"forbidden,omitempty"`
+}
+
+// maxArchiveBytes keeps the compressed archive under the 1MiB ConfigMap limit.
+const maxArchiveBytes = maxDatasetBytes
+
+const (
+	defaultArchiveMaxBytes   = 50 << 20
+	defaultArchiveMaxEntries = 2000
+)
+
+func (p *ArchivePolicy) maxBytes() int64 {
+	if p == nil || p.MaxBytes == 0 {
+		return defaultArchiveMaxBytes
+	}
+	return p.MaxBytes
+}
+
+func (p *ArchivePolicy) maxEntries() int {
+	if p == nil || p.MaxEntries == 0 {
+		return defaultArchiveMaxEntries
+	}
+	return p.MaxEntries
+}
+
+// validateArchive inspects a submission zip and returns everything wrong
+// with it, or nil. Entries are decompressed to measure their real size, so
+// archives that lie about it in their headers are caught too.
+func validateArchive(data []byte, p *ArchivePolicy) []string {
+	if len(data) > maxArchiveBytes {
+		return []string{fmt.Sprintf("The archive is %d bytes; submissions must be under %d bytes.", len(data), maxArchiveBytes)}
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return []string{fmt.Sprintf("The submission is not a valid zip archive: %v.", err)}
+	}
+	if len(zr.File) > p.maxEntries() {
+		return []string{fmt.Sprintf("The archive has %d entries; at most %d are allowed.", len(zr.File), p.maxEntries())}
+	}
+
+	var problems []string
+	var names []string
+	budget := p.maxBytes()
+	for _, f := range zr.File {
+		name := strings.TrimSuffix(f.Name, "/")
+		if unsafeEntryPath(f.Name) {
+			problems = append(problems, fmt.Sprintf("%q would be extracted outside the submission directory.", f.Name))
+			continue
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			problems = append(problems, fmt.Sprintf("%q is a symbolic link; links are not allowed.", f.Name))
+			continue
+		}
+		names = append(names, name)
+		if f.FileInfo().IsDir() || budget < 0 {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%q cannot be read: %v.", f.Name, err))
+			continue
+		}
+		n, err := io.Copy(io.Discard, io.LimitReader(rc, budget+1))
+		rc.Close()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%q is corrupt: %v.", f.Name, err))
+			continue
+		}
+		budget -= n
+		if budget < 0 {
+			problems = append(problems, fmt.Sprintf("The archive is over %d bytes once extracted.", p.maxBytes()))
+		}
+	}
+
+	if p == nil {
+		return problems
+	}
+	for _, glob := range p.Required {
+		found := false
+		for _, name := range names {
+			if globMatch(glob, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("Nothing in the archive matches %q, which is required.", glob))
+		}
+	}
+	for _, glob := range p.Forbidden {
+		for _, name := range names {
+			if globMatch(glob, name) {
+				problems = append(problems, fmt.Sprintf("%q matches %q, which is not allowed.", name, glob))
+			}
+		}
+	}
+	return problems
+}
+
+// unsafeEntryPath reports whether unzipping the entry could write outside the
+// destination directory.
+func unsafeEntryPath(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/") // unzip treats backslashes as separators
+	if name == "" || strings.HasPrefix(name, "/") {
+		return true
+	}
+	for _, part := range strings.Split(path.Clean(name), "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectSubmission records a submission the server refused to run as failed
+// and answers with its results.json.
+func rejectSubmission(w http.ResponseWriter, rec *JobRecord, results []byte, reason, detail string) {
+	rec.Status = statusFailed
+	rec.Finished = time.Now()
+	rec.Results = results
+	rec.FailureReason = reason
+	rec.Error = detail
+	putJob(rec)
+	log.Printf("Job %s refused (%s): %s", rec.ID, reason, detail)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/status/"+rec.ID)
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write(results)
+}
+
+// invalidArchiveResults is the results.json sent back for a submission that
+// failed validation.
+func invalidArchiveResults(problems []string) []byte {
+	zero := 0.0
+	msg := "Your submission was not graded because the archive has problems:\n"
+	for _, p := range problems {
+		msg += "\n- " + p
+	}
+	data, _ := json.Marshal(gradescope.Results{Score: &zero, Output: msg})
+	return data
+}
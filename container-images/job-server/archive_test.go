@@ -0,0 +1,133 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+type zipEntry struct {
+	name     string
+	contents string
+	mode     fs.FileMode // 0 for a regular file
+}
+
+func testZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			h.SetMode(e.mode)
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.contents))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUnsafeEntryPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"main.c", false},
+		{"PA2/src/main.c", false},
+		{"PA2/", false},
+		{"./PA2/main.c", false},
+		{"a/../b", false},
+		{"..foo/bar", false},
+		{"", true},
+		{"/etc/passwd", true},
+		{"../x", true},
+		{"a/../../x", true},
+		{"a/b/../../..", true},
+		{`..\x`, true},
+		{`\abs`, true},
+		{`a\..\..\x`, true},
+	}
+	for _, tt := range tests {
+		if got := unsafeEntryPath(tt.name); got != tt.want {
+			t.Errorf("unsafeEntryPath(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateArchive(t *testing.T) {
+	pa2 := &ArchivePolicy{Required: []string{"*PA2/Makefile"}, Forbidden: []string{"*.o"}}
+	tests := []struct {
+		name     string
+		data     []byte
+		policy   *ArchivePolicy
+		problems []string // substrings, one per expected problem
+	}{
+		{
+			name: "clean archive without a policy",
+			data: testZip(t, zipEntry{name: "main.c", contents: "int main() {}"}),
+		},
+		{
+			name:   "required and forbidden globs pass",
+			data:   testZip(t, zipEntry{name: "PA2/", mode: fs.ModeDir | 0o755}, zipEntry{name: "PA2/Makefile", contents: "all:"}),
+			policy: pa2,
+		},
+		{
+			name:     "missing required file and a forbidden one",
+			data:     testZip(t, zipEntry{name: "PA2/main.o", contents: "\x7fELF"}),
+			policy:   pa2,
+			problems: []string{`matches "*PA2/Makefile", which is required`, `"PA2/main.o" matches "*.o"`},
+		},
+		{
+			name:     "path traversal and absolute paths",
+			data:     testZip(t, zipEntry{name: "../evil.sh", contents: "x"}, zipEntry{name: "/etc/cron.d/x", contents: "x"}, zipEntry{name: "ok.c"}),
+			problems: []string{`"../evil.sh" would be extracted outside`, `"/etc/cron.d/x" would be extracted outside`},
+		},
+		{
+			name:     "symbolic link",
+			data:     testZip(t, zipEntry{name: "link", contents: "/etc/passwd", mode: fs.ModeSymlink | 0o777}),
+			problems: []string{`"link" is a symbolic link`},
+		},
+		{
+			name:     "too big once extracted",
+			data:     testZip(t, zipEntry{name: "a", contents: strings.Repeat("0", 600)}, zipEntry{name: "b", contents: strings.Repeat("0", 600)}),
+			policy:   &ArchivePolicy{MaxBytes: 1000},
+			problems: []string{"over 1000 bytes once extracted"},
+		},
+		{
+			name:     "too many entries",
+			data:     testZip(t, zipEntry{name: "a"}, zipEntry{name: "b"}, zipEntry{name: "c"}),
+			policy:   &ArchivePolicy{MaxEntries: 2},
+			problems: []string{"has 3 entries; at most 2"},
+		},
+		{
+			name:     "not a zip",
+			data:     []byte("definitely not a zip"),
+			problems: []string{"not a valid zip archive"},
+		},
+		{
+			name:     "over the upload limit",
+			data:     make([]byte, maxArchiveBytes+1),
+			problems: []string{"submissions must be under"},
+		},
+	}
+	for _, tt := range tests {
+		got := validateArchive(tt.data, tt.policy)
+		if len(got) != len(tt.problems) {
+			t.Errorf("%s: problems %q, want %d", tt.name, got, len(tt.problems))
+			continue
+		}
+		for i, want := range tt.problems {
+			if !strings.Contains(got[i], want) {
+				t.Errorf("%s: problem %q, want it to mention %q", tt.name, got[i], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// archiveDir holds every uploaded submission archive, named by its SHA-256,
+// so submissions can be audited and regraded later. Like the other state
+// under /app it belongs on the persistent volume.
+const archiveDir = "/app/archives"
+
+var validArchiveHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// archiveMutex serialises writes and sweeps of archiveDir.
+var archiveMutex sync.Mutex
+
+func archivePath(hash string) string {
+	return filepath.Join(archiveDir, hash[:2], hash+".zip")
+}
+
+// storeArchive saves an uploaded archive and returns its hash. An archive
+// that is already stored is not written again; its modification time is
+// bumped so retention counts from the latest upload.
+func storeArchive(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	p := archivePath(hash)
+
+	archiveMutex.Lock()
+	defer archiveMutex.Unlock()
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return hash, fmt.Errorf("creating archive directory: %v", err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(p), "archive_tmp_*")
+	if err != nil {
+		return hash, fmt.Errorf("storing archive: %v", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return hash, fmt.Errorf("storing archive: %v", err)
+	}
+	file.Close()
+	if err := os.Rename(file.Name(), p); err != nil { // atomic replace
+		os.Remove(file.Name())
+		return hash, fmt.Errorf("storing archive: %v", err)
+	}
+	return hash, nil
+}
+
+// loadArchive returns a stored archive by hash.
+func loadArchive(hash string) ([]byte, error) {
+	if !validArchiveHash.MatchString(hash) {
+		return nil, fmt.Errorf("invalid archive hash %q", hash)
+	}
+	data, err := os.ReadFile(archivePath(hash))
+	if err != nil {
+		return nil, fmt.Errorf("archive %s: %v", hash, err)
+	}
+	return data, nil
+}
+
+// keepArchive checks that an archive is stored and restarts its retention
+// period, so a job queued to run it still finds it when it is dispatched.
+func keepArchive(hash string) error {
+	if !validArchiveHash.MatchString(hash) {
+		return fmt.Errorf("invalid archive hash %q", hash)
+	}
+	archiveMutex.Lock()
+	defer archiveMutex.Unlock()
+	now := time.Now()
+	if err := os.Chtimes(archivePath(hash), now, now); err != nil {
+		return fmt.Errorf("archive %s: %v", hash, err)
+	}
+	return nil
+}
+
+// archiveRetention reads ARCHIVE_RETENTION, e.g. "2160h" for 90 days. Unset
+// or zero keeps archives forever.
+func archiveRetention() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("ARCHIVE_RETENTION"))
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// sweepArchives deletes archives last uploaded before the retention period.
+func sweepArchives() {
+	retention := archiveRetention()
+	if retention == 0 {
+		return
+	}
+	cutoff := time.Now().Add(-retention)
+	archiveMutex.Lock()
+	defer archiveMutex.Unlock()
+	removed := 0
+	filepath.WalkDir(archiveDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Before(cutoff) {
+			if os.Remove(p) == nil {
+				removed++
+			}
+		}
+		return nil
+	})
+	if removed > 0 {
+		log.Printf("Removed %d archives older than %s", removed, retention)
+	}
+}
+
+// expireArchives runs sweepArchives and pruneResultCache every hour.
+func expireArchives() {
+	for {
+		sweepArchives()
+		pruneResultCache()
+		time.Sleep(time.Hour)
+	}
+}
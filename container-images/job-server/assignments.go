@@ -0,0 +1,144 @@
+package main
+
+// Assignment describes how submissions for one assignment are graded.
+type Assignment struct {
+	ConfigMeta
+	Name    string   `json:"name,omitempty"`
+	Image   string   `json:"image,omitempty"`
+	Command []string `json:"command,omitempty"`
+
+	// Tenant is the course or workload class the assignment's jobs are
+	// charged to for fair-share scheduling (see tenants.go).
+	Tenant string `json:"tenant,omitempty"`
+
+	// Resources sets the runner's CPU/memory requests and limits.
+	Resources *ResourceConfig `json:"resources,omitempty"`
+	// OpenCL is the number of GPU slots a run needs on its phone (0 for CPU-only).
+	OpenCL int `json:"opencl,omitempty"`
+	// Security names the runner's SecurityProfile (default "restricted").
+	Security string `json:"security,omitempty"`
+
+	// ResultFormat is what the runner prints on stdout: "gradescope" (results.json),
+	// "junit" (JUnit XML) or "tap". Left empty, the format is auto-detected.
+	ResultFormat string `json:"result_format,omitempty"`
+	// TestPoints weights converted JUnit/TAP tests by name. Tests not listed
+	// are worth DefaultTestPoints (0 means 1 point).
+	TestPoints        map[string]float64 `json:"test_points,omitempty"`
+	DefaultTestPoints float64            `json:"default_test_points,omitempty"`
+
+	// Scoring, if set, reweights tests, caps the score, applies late
+	// penalties and test visibility on top of the runner's results.
+	Scoring *ScoringPolicy `json:"scoring,omitempty"`
+
+	// Benchmark, if set, reserves a whole phone for each run and times the
+	// assignment's hot path (see BenchmarkConfig).
+	Benchmark *BenchmarkConfig `json:"benchmark,omitempty"`
+
+	// TestBundle, if set, mounts the hidden tests uploaded through
+	// /admin/bundles/ into the runner read-only.
+	TestBundle *BundleConfig `json:"test_bundle,omitempty"`
+
+	// Archive limits the size and contents of submitted archives; nil
+	// applies the default limits only.
+	Archive *ArchivePolicy `json:"archive,omitempty"`
+
+	// Prechecks run in the server on every submission that passed the
+	// archive checks, before it is queued (see precheck.go).
+	Prechecks []PrecheckConfig `json:"prechecks,omitempty"`
+
+	// CacheResults reuses the results of an earlier run of the same archive
+	// with the same image digest, test bundle version and configuration
+	// instead of grading it again. The image must be pinned by digest; it is
+	// ignored for benchmarks.
+	CacheResults bool `json:"cache_results,omitempty"`
+
+	// Dataset, if set, generates fresh inputs and expected outputs for
+	// every submission instead of relying on the checked-in Dataset/ folders.
+	Dataset *DatasetConfig `json:"dataset,omitempty"`
+}
+
+// pa2Command unzips the submission, finds the PA2 folder and runs `make run`,
+// emitting only the JSON results on stdout. When the assignment generates a
+// dataset it replaces the student's Dataset folder; it is copied rather than
+// linked because the Makefile writes its outputs next to the inputs and the
+// mount is read-only.
+var pa2Command = []string{
+	"sh", "-c",
+	// ① unzip silently
+	"unzip /scripts/archive.zip -d $HOME >/dev/null 2>&1 && " +
+		// ② locate the PA2 folder (first match) and cd into it, suppressing errors
+		"PA2DIR=$(find $HOME -type d -name PA2 | head -n1) && " +
+		"{ cd \"$PA2DIR\" 2>/dev/null || EXIT=1; } && " +
+		// ③ swap in the generated dataset, if any
+		"if [ \"$EXIT\" != \"1\" ] && [ -n \"$DATASET_DIR\" ]; then " +
+		"rm -rf Dataset && mkdir Dataset && cp -rL \"$DATASET_DIR\"/[0-9]* Dataset/ || EXIT=1; fi; " +
+		// ④ run make, capture output and exit‐code only if cd succeeded
+		"if [ \"$EXIT\" != \"1\" ]; then make -s run > /tmp/out 2>&1; EXIT=$?; fi; " +
+		// ⑤ emit *only* JSON, then exit 0
+		"if [ \"$EXIT\" != \"0\" ]; then echo '{\"score\":0}'; else cat /tmp/out; fi",
+}
+
+// defaultAssignment is used for any assignment name not listed below.
+var defaultAssignment = &Assignment{
+	Name:  "default",
+	Image: "rsankar12/opencl_cse160", //Rishab's OpenCL image for container
+	// Image: "arunanthivi/job-grader:python", //Python image for container
+	Command: pa2Command,
+}
+
+// assignments maps the (sanitized) assignment name sent in the `image` form field
+// to its grading configuration. These are the built-in assignments; once the
+// admin API has changed anything the table is loaded from configFile instead.
+var assignments = map[string]*Assignment{
+	"pa2": {
+		Name:    "pa2",
+		Image:   "rsankar12/opencl_cse160",
+		Command: pa2Command,
+		Tenant:  "cse160",
+		Archive: &ArchivePolicy{Required: []string{"*PA2/Makefile"}},
+		Resources: &ResourceConfig{
+			CPURequest:            "500m",
+			CPULimit:              "2",
+			MemoryRequest:         "256Mi",
+			MemoryLimit:           "512Mi",
+			EphemeralStorageLimit: "1Gi",
+		},
+		OpenCL: 1,
+		Prechecks: []PrecheckConfig{
+			{
+				Name:   "kernels define vectorAdd",
+				Check:  "regex",
+				Files:  "*PA2/vector_add_*.cl",
+				Params: map[string]string{"pattern": `__kernel\s+void\s+vectorAdd\s*\(`},
+			},
+			{
+				Name:   "no OpenMP",
+				Check:  "regex",
+				Files:  "*PA2/*.c",
+				Params: map[string]string{"pattern": `#\s*include\s*<omp\.h>`, "mode": "forbid"},
+			},
+			{
+				Name:     "small sources",
+				Check:    "file",
+				Files:    "*PA2/*.c",
+				Params:   map[string]string{"max_bytes": "204800"},
+				Severity: severityWarning,
+			},
+		},
+		Dataset: &DatasetConfig{
+			Generator: "vector_add",
+			MountPath: "/dataset",
+			// One size per folder the PA2 Makefile runs (Dataset/0-9).
+			Params: map[string]string{"arrays": "4", "sizes": "1,2,16,64,256,1024,2048,4096,8192,16384"},
+		},
+	},
+}
+
+func lookupAssignment(name string) *Assignment {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	if a, ok := assignments[name]; ok {
+		return a
+	}
+	return defaultAssignment
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles a principal can hold.
+const (
+	roleAdmin      = "admin"      // everything, on every course
+	roleInstructor = "instructor" // assignments, test bundles and regrades of their courses
+	roleTA         = "ta"         // view jobs and logs of their courses
+	roleGradescope = "gradescope" // submit and poll
+)
+
+// Permissions checked by the handlers.
+const (
+	permSubmit   = "submit"
+	permPoll     = "poll"     // /status/ of a job
+	permViewJobs = "viewjobs" // job lists, logs, assignment settings
+	permManage   = "manage"   // assignments, bundles, staff and bulk priority
+	permAdmin    = "admin"    // courses, namespaces, tokens, metrics
+)
+
+var rolePermissions = map[string][]string{
+	roleAdmin:      {permSubmit, permPoll, permViewJobs, permManage, permAdmin},
+	roleInstructor: {permSubmit, permPoll, permViewJobs, permManage},
+	roleTA:         {permPoll, permViewJobs},
+	roleGradescope: {permSubmit, permPoll},
+}
+
+// principalsFile persists the issued tokens (as hashes) and their principals.
+const principalsFile = "/app/principals.json"
+
+// Principal is someone (or something) holding an API token.
+type Principal struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Role    string    `json:"role"`
+	Courses []string  `json:"courses,omitempty"` // "*" for every course
+	Created time.Time `json:"created"`
+	Revoked bool      `json:"revoked,omitempty"`
+	// TokenHash is the SHA-256 of the token; the token itself is only shown
+	// once, when it is issued.
+	TokenHash string `json:"token_hash,omitempty"`
+}
+
+// can reports whether the principal has perm on course. Admin-only
+// permissions ignore the course.
+func (p *Principal) can(perm, course string) bool {
+	if p == nil || p.Revoked || !slices.Contains(rolePermissions[p.Role], perm) {
+		return false
+	}
+	if p.Role == roleAdmin {
+		return true
+	}
+	if perm == permAdmin {
+		return false
+	}
+	return slices.Contains(p.Courses, "*") || slices.Contains(p.Courses, course)
+}
+
+var (
+	principals      = map[string]*Principal{}
+	principalsMutex sync.Mutex
+)
+
+func init() {
+	data, err := os.ReadFile(principalsFile)
+	if err == nil {
+		var list []*Principal
+		if err := json.Unmarshal(data, &list); err != nil {
+			log.Printf("Ignoring unreadable %s: %v", principalsFile, err)
+			return
+		}
+		for _, p := range list {
+			principals[p.ID] = p
+		}
+	}
+}
+
+// savePrincipals writes principalsFile; principalsMutex must be held.
+func savePrincipals() error {
+	list := make([]*Principal, 0, len(principals))
+	for _, p := range principals {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(principalsFile), "principals_tmp_*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	file.Close()
+	if err := os.Rename(file.Name(), principalsFile); err != nil { // atomic replace
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
+
+// errNotSaved is returned when a token change could not be persisted; the
+// change is undone, since a restart would otherwise silently revert it.
+var errNotSaved = errors.New("could not save the tokens")
+
+// issueToken creates a principal and returns it with its token.
+func issueToken(name, role string, courses []string) (*Principal, string, error) {
+	if _, ok := rolePermissions[role]; !ok {
+		return nil, "", fmt.Errorf("unknown role %q", role)
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	if role != roleAdmin && len(courses) == 0 {
+		return nil, "", fmt.Errorf("a %s token needs at least one course", role)
+	}
+	token := "gg_" + randomHex(32)
+	p := &Principal{
+		ID:        randomHex(8),
+		Name:      name,
+		Role:      role,
+		Courses:   courses,
+		Created:   time.Now(),
+		TokenHash: hashToken(token),
+	}
+	principalsMutex.Lock()
+	defer principalsMutex.Unlock()
+	principals[p.ID] = p
+	if err := savePrincipals(); err != nil {
+		delete(principals, p.ID)
+		log.Printf("Saving %s: %v", principalsFile, err)
+		return nil, "", errNotSaved
+	}
+	return p, token, nil
+}
+
+// authenticate returns the principal behind the request's bearer token, or nil.
+// ADMIN_TOKEN, if set, is a bootstrap admin token for issuing the first tokens;
+// with ALLOW_ANONYMOUS_SUBMIT=true requests without a token may submit and poll.
+func authenticate(r *http.Request) *Principal {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		if os.Getenv("ALLOW_ANONYMOUS_SUBMIT") == "true" {
+			return &Principal{ID: "anonymous", Name: "anonymous", Role: roleGradescope, Courses: []string{"*"}}
+		}
+		return nil
+	}
+	hash := hashToken(token)
+	if admin := os.Getenv("ADMIN_TOKEN"); admin != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(hashToken(admin))) == 1 {
+		return &Principal{ID: "bootstrap", Name: "ADMIN_TOKEN", Role: roleAdmin}
+	}
+	principalsMutex.Lock()
+	defer principalsMutex.Unlock()
+	for _, p := range principals {
+		if !p.Revoked && subtle.ConstantTimeCompare([]byte(hash), []byte(p.TokenHash)) == 1 {
+			copied := *p
+			return &copied
+		}
+	}
+	return nil
+}
+
+type principalKey struct{}
+
+// authenticated is the middleware in front of every API handler: requests
+// without a valid token are refused, the rest carry their principal.
+func authenticated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := authenticate(r)
+		if p == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "A valid API token is required", http.StatusUnauthorized)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+func principalFrom(r *http.Request) *Principal {
+	p, _ := r.Context().Value(principalKey{}).(*Principal)
+	return p
+}
+
+// allowed checks perm on course for the request's principal, answering 403 if not.
+func allowed(w http.ResponseWriter, r *http.Request, perm, course string) bool {
+	if principalFrom(r).can(perm, course) {
+		return true
+	}
+	http.Error(w, "Not allowed", http.StatusForbidden)
+	return false
+}
+
+// tokensHandler serves /admin/tokens: POST issues a token for
+// {"name", "role", "courses"}, GET lists the principals, and
+// DELETE /admin/tokens/{id} revokes one.
+func tokensHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permAdmin, "") {
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/tokens"), "/")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		principalsMutex.Lock()
+		list := make([]Principal, 0, len(principals))
+		for _, p := range principals {
+			copied := *p
+			copied.TokenHash = ""
+			list = append(list, copied)
+		}
+		principalsMutex.Unlock()
+		sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+		json.NewEncoder(w).Encode(list)
+
+	case id == "" && r.Method == http.MethodPost:
+		var req struct {
+			Name    string   `json:"name"`
+			Role    string   `json:"role"`
+			Courses []string `json:"courses"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		p, token, err := issueToken(req.Name, req.Role, req.Courses)
+		if errors.Is(err, errNotSaved) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			Principal
+			Token string `json:"token"`
+		}{Principal{ID: p.ID, Name: p.Name, Role: p.Role, Courses: p.Courses, Created: p.Created}, token})
+
+	case id != "" && r.Method == http.MethodDelete:
+		principalsMutex.Lock()
+		p, ok := principals[id]
+		var err error
+		if ok && !p.Revoked {
+			p.Revoked = true
+			if err = savePrincipals(); err != nil {
+				p.Revoked = false
+				log.Printf("Saving %s: %v", principalsFile, err)
+			}
+		}
+		principalsMutex.Unlock()
+		if !ok {
+			http.Error(w, "No such token", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, errNotSaved.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"revoked": id})
+
+	default:
+		http.Error(w, "Unsupported method or path", http.StatusMethodNotAllowed)
+	}
+}
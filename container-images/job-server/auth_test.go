@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withPrincipals replaces the token table for the duration of a test.
+func withPrincipals(t *testing.T, list ...*Principal) {
+	t.Helper()
+	principalsMutex.Lock()
+	saved := principals
+	principals = map[string]*Principal{}
+	for _, p := range list {
+		principals[p.ID] = p
+	}
+	principalsMutex.Unlock()
+	t.Cleanup(func() {
+		principalsMutex.Lock()
+		principals = saved
+		principalsMutex.Unlock()
+	})
+}
+
+// blockFile puts a directory where path should be written, so saving it
+// fails, and skips the test when that is not possible here.
+func blockFile(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(filepath.Dir(path)); err != nil {
+		t.Skipf("%s is not available", filepath.Dir(path))
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Skipf("%s already exists", path)
+	}
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { os.Remove(path) })
+}
+
+func TestPrincipalCan(t *testing.T) {
+	instructor := &Principal{Role: roleInstructor, Courses: []string{"cse160"}}
+	tests := []struct {
+		p            *Principal
+		perm, course string
+		want         bool
+	}{
+		{nil, permPoll, "cse160", false},
+		{&Principal{Role: roleAdmin}, permAdmin, "", true},
+		{&Principal{Role: roleAdmin}, permManage, "any", true},
+		{&Principal{Role: roleAdmin, Revoked: true}, permPoll, "any", false},
+		{instructor, permManage, "cse160", true},
+		{instructor, permManage, "cse120", false},
+		{instructor, permAdmin, "cse160", false},
+		{&Principal{Role: roleTA, Courses: []string{"*"}}, permViewJobs, "cse120", true},
+		{&Principal{Role: roleTA, Courses: []string{"*"}}, permSubmit, "cse120", false},
+		{&Principal{Role: roleGradescope, Courses: []string{"cse160"}}, permSubmit, "cse160", true},
+		{&Principal{Role: "nobody", Courses: []string{"*"}}, permPoll, "cse160", false},
+	}
+	for _, tt := range tests {
+		if got := tt.p.can(tt.perm, tt.course); got != tt.want {
+			t.Errorf("%+v.can(%s, %q) = %v, want %v", tt.p, tt.perm, tt.course, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	withPrincipals(t,
+		&Principal{ID: "live", Role: roleTA, Courses: []string{"cse160"}, TokenHash: hashToken("gg_live")},
+		&Principal{ID: "gone", Role: roleTA, Courses: []string{"cse160"}, TokenHash: hashToken("gg_gone"), Revoked: true},
+	)
+	t.Setenv("ADMIN_TOKEN", "bootstrap-secret")
+	tests := []struct {
+		header    string
+		anonymous string
+		want      string // principal ID, "" for none
+	}{
+		{"Bearer gg_live", "", "live"},
+		{"Bearer gg_gone", "", ""},
+		{"Bearer gg_unknown", "", ""},
+		{"Bearer bootstrap-secret", "", "bootstrap"},
+		{"gg_live", "", ""}, // not a bearer token
+		{"", "", ""},
+		{"", "true", "anonymous"},
+		{"Bearer gg_unknown", "true", ""}, // a bad token is not anonymous
+	}
+	for _, tt := range tests {
+		t.Setenv("ALLOW_ANONYMOUS_SUBMIT", tt.anonymous)
+		r := httptest.NewRequest(http.MethodGet, "/status/x", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		got := ""
+		if p := authenticate(r); p != nil {
+			got = p.ID
+		}
+		if got != tt.want {
+			t.Errorf("Authorization %q (anonymous %q): principal %q, want %q", tt.header, tt.anonymous, got, tt.want)
+		}
+	}
+}
+
+func TestTokenChangesThatFailToSave(t *testing.T) {
+	withPrincipals(t, &Principal{ID: "live", Role: roleTA, Courses: []string{"cse160"}, TokenHash: hashToken("gg_live")})
+	blockFile(t, principalsFile)
+	t.Setenv("ADMIN_TOKEN", "bootstrap-secret")
+	handler := authenticated(tokensHandler)
+
+	for _, tt := range []struct{ method, path, body string }{
+		{http.MethodDelete, "/admin/tokens/live", ""},
+		{http.MethodPost, "/admin/tokens", `{"name": "ta", "role": "ta", "courses": ["cse160"]}`},
+	} {
+		r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		r.Header.Set("Authorization", "Bearer bootstrap-secret")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s %s: status %d, want 500", tt.method, tt.path, w.Code)
+		}
+	}
+
+	principalsMutex.Lock()
+	defer principalsMutex.Unlock()
+	if len(principals) != 1 || principals["live"].Revoked {
+		t.Errorf("failed saves changed the tokens: %+v", principals)
+	}
+}
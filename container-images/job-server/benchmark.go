@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"greengrader/webserver/gradescope"
+
+	corev1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// BenchmarkConfig turns an assignment into a performance-graded one: the job
+// gets a phone to itself and TimedCommand is run Runs times after grading.
+type BenchmarkConfig struct {
+	// TimedCommand is run with `sh -c` from $HOME after the grading command.
+	// Its output is discarded; only its wall-clock time is measured.
+	TimedCommand string `json:"timed_command,omitempty"`
+	Runs         int    `json:"runs,omitempty"` // default 5
+
+	// NodeSelector pins benchmark runs to a phone model or node pool.
+	NodeSelector map[string]string `json:"node_selector,omitempty"`
+
+	// HardwareLabel names the node label identifying the hardware class
+	// (default "node.kubernetes.io/instance-type"). ReferenceSeconds holds the
+	// reference median time per class; with Points set, a run at or under the
+	// reference earns full points, falling linearly to zero at MaxSlowdown
+	// times the reference (default 2).
+	HardwareLabel    string             `json:"hardware_label,omitempty"`
+	ReferenceSeconds map[string]float64 `json:"reference_seconds,omitempty"`
+	Points           float64            `json:"points,omitempty"`
+	MaxSlowdown      float64            `json:"max_slowdown,omitempty"`
+}
+
+// benchmarkMarker prefixes the timing lines the wrapper prints; they are
+// stripped from the output before the results are parsed.
+const benchmarkMarker = "@@benchmark "
+
+// exclusiveLabel marks runner pods that must have their phone to themselves.
+const exclusiveLabel = "greengrader.ucsd.edu/exclusive"
+
+func (b *BenchmarkConfig) runs() int {
+	if b.Runs > 0 {
+		return b.Runs
+	}
+	return 5
+}
+
+func (b *BenchmarkConfig) hardwareLabel() string {
+	if b.HardwareLabel != "" {
+		return b.HardwareLabel
+	}
+	return "node.kubernetes.io/instance-type"
+}
+
+// wrapBenchmark runs the original command, then times BENCHMARK_COMMAND
+// BENCHMARK_RUNS times, printing one marker line per run in nanoseconds.
+func wrapBenchmark(container *corev1.Container, b *BenchmarkConfig) {
+	script := `"$@"; cd "$HOME"; i=0; while [ $i -lt "$BENCHMARK_RUNS" ]; do ` +
+		`s=$(date +%s%N); sh -c "$BENCHMARK_COMMAND" >/dev/null 2>&1; e=$(date +%s%N); ` +
+		`echo "` + benchmarkMarker + `$((e - s))"; i=$((i + 1)); done`
+	container.Command = append([]string{"sh", "-c", script, "--"}, container.Command...)
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "BENCHMARK_COMMAND", Value: b.TimedCommand},
+		corev1.EnvVar{Name: "BENCHMARK_RUNS", Value: strconv.Itoa(b.runs())},
+	)
+}
+
+// makeExclusive keeps other runner pods off the benchmark's phone. Required
+// anti-affinity is honoured in both directions by the scheduler, so later
+// runner pods also avoid a phone that is running a benchmark.
+func makeExclusive(tmpl *corev1.PodTemplateSpec, b *BenchmarkConfig) {
+	tmpl.Labels[exclusiveLabel] = "true"
+	if len(b.NodeSelector) > 0 {
+		if tmpl.Spec.NodeSelector == nil {
+			tmpl.Spec.NodeSelector = map[string]string{}
+		}
+		for k, v := range b.NodeSelector {
+			tmpl.Spec.NodeSelector[k] = v
+		}
+	}
+	if tmpl.Spec.Affinity == nil {
+		tmpl.Spec.Affinity = &corev1.Affinity{}
+	}
+	tmpl.Spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{{
+			LabelSelector: &meta.LabelSelector{MatchLabels: map[string]string{runnerRoleLabel: "runner"}},
+			TopologyKey:   "kubernetes.io/hostname",
+		}},
+	}
+}
+
+// splitBenchmarkOutput separates the timing lines from the runner's output.
+func splitBenchmarkOutput(logs []byte) ([]byte, []float64) {
+	var out bytes.Buffer
+	var seconds []float64
+	for _, line := range bytes.SplitAfter(logs, []byte("\n")) {
+		if rest, ok := bytes.CutPrefix(line, []byte(benchmarkMarker)); ok {
+			if ns, err := strconv.ParseInt(string(bytes.TrimSpace(rest)), 10, 64); err == nil {
+				seconds = append(seconds, float64(ns)/1e9)
+			}
+			continue
+		}
+		out.Write(line)
+	}
+	return out.Bytes(), seconds
+}
+
+// benchmarkStats summarises the run times.
+type benchmarkStats struct {
+	Runs          int       `json:"runs"`
+	Times         []float64 `json:"times_s"`
+	MedianSeconds float64   `json:"median_s"`
+	MinSeconds    float64   `json:"min_s"`
+	MaxSeconds    float64   `json:"max_s"`
+	StdDevSeconds float64   `json:"stddev_s"`
+	// Spread is (max - min) / median, a quick noise indicator.
+	Spread          float64 `json:"spread"`
+	HardwareClass   string  `json:"hardware_class,omitempty"`
+	ReferenceMedian float64 `json:"reference_s,omitempty"`
+}
+
+func summarise(times []float64) benchmarkStats {
+	st := benchmarkStats{Runs: len(times), Times: times}
+	if len(times) == 0 {
+		return st
+	}
+	sorted := append([]float64(nil), times...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	st.MinSeconds, st.MaxSeconds = sorted[0], sorted[n-1]
+	if n%2 == 1 {
+		st.MedianSeconds = sorted[n/2]
+	} else {
+		st.MedianSeconds = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	mean := 0.0
+	for _, t := range sorted {
+		mean += t
+	}
+	mean /= float64(n)
+	for _, t := range sorted {
+		st.StdDevSeconds += (t - mean) * (t - mean)
+	}
+	st.StdDevSeconds = math.Sqrt(st.StdDevSeconds / float64(n))
+	if st.MedianSeconds > 0 {
+		st.Spread = (st.MaxSeconds - st.MinSeconds) / st.MedianSeconds
+	}
+	return st
+}
+
+// nodeHardwareClass looks up the hardware class label of the node the job ran on.
+func nodeHardwareClass(clientset kubernetes.Interface, nodeName string, b *BenchmarkConfig) string {
+	if nodeName == "" {
+		return ""
+	}
+	node, err := clientset.CoreV1().Nodes().Get(context.TODO(), nodeName, meta.GetOptions{})
+	if err != nil {
+		return ""
+	}
+	return node.Labels[b.hardwareLabel()]
+}
+
+// applyBenchmark adds the timing summary to extra_data and, when a reference
+// time exists for the hardware class, a performance test worth b.Points.
+func applyBenchmark(b *BenchmarkConfig, results []byte, times []float64, hardwareClass string) ([]byte, error) {
+	res, err := parseRawResults(results)
+	if err != nil {
+		return nil, fmt.Errorf("parsing results for benchmark: %w", err)
+	}
+	st := summarise(times)
+	st.HardwareClass = hardwareClass
+	st.ReferenceMedian = b.ReferenceSeconds[hardwareClass]
+	if res.ExtraData == nil {
+		res.ExtraData = map[string]any{}
+	}
+	res.ExtraData["benchmark"] = st
+
+	if b.Points > 0 && st.ReferenceMedian > 0 {
+		test := gradescope.Test{Name: "Performance", MaxScore: b.Points, Status: gradescope.Failed}
+		if st.Runs == 0 {
+			test.Output = "The timed section did not run."
+		} else {
+			slow := b.MaxSlowdown
+			if slow <= 1 {
+				slow = 2
+			}
+			ratio := st.MedianSeconds / st.ReferenceMedian
+			frac := math.Max(0, math.Min(1, (slow-ratio)/(slow-1)))
+			test.Score = frac * b.Points
+			if frac == 1 {
+				test.Status = gradescope.Passed
+			}
+			test.Output = fmt.Sprintf("Median %.4fs over %d runs (spread %.1f%%), reference %.4fs on %s.",
+				st.MedianSeconds, st.Runs, st.Spread*100, st.ReferenceMedian, hardwareClass)
+		}
+		if res.Score != nil && len(res.Tests) == 0 {
+			// keep the runner's score and add the performance points to it
+			res.Tests = append(res.Tests, gradescope.Test{Name: "Correctness", Score: *res.Score})
+		}
+		res.Score = nil
+		res.Tests = append(res.Tests, test)
+	}
+	return res.marshal()
+}
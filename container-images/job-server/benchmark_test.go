@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"greengrader/webserver/gradescope"
+)
+
+func TestSummarise(t *testing.T) {
+	tests := []struct {
+		times                            []float64
+		median, min, max, stddev, spread float64
+	}{
+		{nil, 0, 0, 0, 0, 0},
+		{[]float64{2}, 2, 2, 2, 0, 0},
+		{[]float64{3, 1, 2}, 2, 1, 3, math.Sqrt(2.0 / 3), 1},
+		{[]float64{4, 1, 2, 3}, 2.5, 1, 4, math.Sqrt(1.25), 1.2},
+		{[]float64{0, 0}, 0, 0, 0, 0, 0},
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	for _, tt := range tests {
+		st := summarise(tt.times)
+		if st.Runs != len(tt.times) || !near(st.MedianSeconds, tt.median) || !near(st.MinSeconds, tt.min) ||
+			!near(st.MaxSeconds, tt.max) || !near(st.StdDevSeconds, tt.stddev) || !near(st.Spread, tt.spread) {
+			t.Errorf("summarise(%v) = %+v", tt.times, st)
+		}
+	}
+	times := []float64{3, 1, 2}
+	summarise(times)
+	if times[0] != 3 {
+		t.Error("summarise reordered the run times")
+	}
+}
+
+func TestApplyBenchmark(t *testing.T) {
+	b := &BenchmarkConfig{ReferenceSeconds: map[string]float64{"pixel": 2}, Points: 10}
+	tests := []struct {
+		name    string
+		b       *BenchmarkConfig
+		results string
+		times   []float64
+		class   string
+		score   float64 // of the Performance test, -1 when there is none
+		status  string
+		tests   int
+	}{
+		{"at the reference", b, `{"tests":[{"name":"t1","score":1}]}`, []float64{2, 2, 2}, "pixel", 10, gradescope.Passed, 2},
+		{"faster than the reference", b, `{"tests":[]}`, []float64{1}, "pixel", 10, gradescope.Passed, 1},
+		{"half way to the slowdown limit", b, `{"tests":[]}`, []float64{3}, "pixel", 5, gradescope.Failed, 1},
+		{"at the slowdown limit", b, `{"tests":[]}`, []float64{4}, "pixel", 0, gradescope.Failed, 1},
+		{"beyond the slowdown limit", b, `{"tests":[]}`, []float64{9}, "pixel", 0, gradescope.Failed, 1},
+		{"custom slowdown limit", &BenchmarkConfig{ReferenceSeconds: map[string]float64{"pixel": 2}, Points: 10, MaxSlowdown: 3}, `{"tests":[]}`, []float64{4}, "pixel", 5, gradescope.Failed, 1},
+		{"timed section did not run", b, `{"tests":[]}`, nil, "pixel", 0, gradescope.Failed, 1},
+		{"runner score kept as correctness", b, `{"score":7}`, []float64{2}, "pixel", 10, gradescope.Passed, 2},
+		{"no reference for the class", b, `{"tests":[]}`, []float64{2}, "galaxy", -1, "", 0},
+		{"no points", &BenchmarkConfig{ReferenceSeconds: map[string]float64{"pixel": 2}}, `{"tests":[]}`, []float64{2}, "pixel", -1, "", 0},
+	}
+	for _, tt := range tests {
+		out, err := applyBenchmark(tt.b, []byte(tt.results), tt.times, tt.class)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var res gradescope.Results
+		if err := json.Unmarshal(out, &res); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(res.Tests) != tt.tests {
+			t.Errorf("%s: %d tests, want %d: %s", tt.name, len(res.Tests), tt.tests, out)
+			continue
+		}
+		if tt.score < 0 {
+			continue
+		}
+		perf := res.Tests[len(res.Tests)-1]
+		if perf.Name != "Performance" || math.Abs(perf.Score-tt.score) > 1e-9 || perf.Status != tt.status || perf.MaxScore != 10 {
+			t.Errorf("%s: performance test %+v, want score %v and status %q", tt.name, perf, tt.score, tt.status)
+		}
+		if res.Score != nil {
+			t.Errorf("%s: the top-level score %v would override the tests", tt.name, *res.Score)
+		}
+	}
+}
+
+func TestApplyBenchmarkKeepsUnmodelledKeys(t *testing.T) {
+	b := &BenchmarkConfig{ReferenceSeconds: map[string]float64{"pixel": 2}, Points: 10}
+	out, err := applyBenchmark(b, []byte(`{"tests":[{"name":"t1","score":1,"hint":"x"}],"n_time":3}`), []float64{2}, "pixel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"hint":"x"`, `"n_time":3`, `"benchmark":{`, `"hardware_class":"pixel"`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("results lack %s: %s", want, out)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// BundleConfig mounts an instructor-uploaded test bundle into the runner.
+type BundleConfig struct {
+	Name      string `json:"name,omitempty"`
+	MountPath string `json:"mount_path,omitempty"` // default /tests, exported as $TESTS_DIR
+	// Version pins a bundle version; 0 uses the latest upload.
+	Version int `json:"version,omitempty"`
+}
+
+// Labels and annotations on the Secrets that store the uploaded bundles.
+const (
+	bundleLabel          = "greengrader.ucsd.edu/bundle"
+	bundleVersionLabel   = "greengrader.ucsd.edu/bundle-version"
+	bundleCourseLabel    = tenantLabel // the course that owns the bundle
+	bundleHashAnnotation = "greengrader.ucsd.edu/sha256"
+	bundleKey            = "bundle.zip"
+)
+
+// maxBundleBytes keeps the extracted bundle under the 1MiB Secret limit.
+const maxBundleBytes = maxDatasetBytes
+
+var validBundlePath = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)*$`)
+
+// bundleVersion is one stored upload of a bundle.
+type bundleVersion struct {
+	Name     string    `json:"name"`
+	Version  int       `json:"version"`
+	Course   string    `json:"course"`
+	SHA256   string    `json:"sha256"`
+	Uploaded time.Time `json:"uploaded"`
+	Files    []string  `json:"files,omitempty"`
+}
+
+func bundleSecretName(name string, version int) string {
+	return fmt.Sprintf("bundle-%s-v%d", name, version)
+}
+
+// extractBundle unpacks a bundle zip, checking that every file can be mounted
+// from a Secret and that the whole bundle fits in one.
+func extractBundle(data []byte) (map[string][]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("bundle is not a zip archive: %v", err)
+	}
+	files := map[string][]byte{}
+	keys := map[string]string{}
+	total := 0
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := path.Clean(f.Name)
+		if !validBundlePath.MatchString(name) || strings.HasPrefix(name, "..") {
+			return nil, fmt.Errorf("bundle file name %q is not allowed (letters, digits, '.', '_', '-' and '/')", f.Name)
+		}
+		key := strings.ReplaceAll(name, "/", "-")
+		if other, ok := keys[key]; ok {
+			return nil, fmt.Errorf("bundle files %q and %q clash", other, name)
+		}
+		keys[key] = name
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", name, err)
+		}
+		contents, err := io.ReadAll(io.LimitReader(rc, maxBundleBytes+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", name, err)
+		}
+		total += len(contents)
+		if total > maxBundleBytes {
+			return nil, fmt.Errorf("bundle is over the %d byte limit once extracted", maxBundleBytes)
+		}
+		files[name] = contents
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("bundle is empty")
+	}
+	return files, nil
+}
+
+// listBundleVersions returns the stored versions of a bundle, oldest first.
+func listBundleVersions(clientset kubernetes.Interface, name string) ([]bundleVersion, error) {
+	secrets, err := clientset.CoreV1().Secrets(serverNamespace()).List(context.TODO(), meta.ListOptions{
+		LabelSelector: bundleLabel + "=" + name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var versions []bundleVersion
+	for _, s := range secrets.Items {
+		v, err := strconv.Atoi(s.Labels[bundleVersionLabel])
+		if err != nil {
+			continue
+		}
+		versions = append(versions, bundleVersion{
+			Name:     name,
+			Version:  v,
+			Course:   s.Labels[bundleCourseLabel],
+			SHA256:   s.Annotations[bundleHashAnnotation],
+			Uploaded: s.CreationTimestamp.Time,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// bundleMutex serialises uploads so two of them never pick the same version.
+// Another server replica can still race; the Secret name is derived from the
+// version, so the loser gets AlreadyExists and retries with the next number.
+var bundleMutex sync.Mutex
+
+// bundleStoreAttempts bounds the retries when another upload takes the version.
+const bundleStoreAttempts = 5
+
+// storeBundle validates an uploaded bundle and saves it as the next version
+// of the course's bundle.
+func storeBundle(clientset kubernetes.Interface, name, course string, data []byte) (*bundleVersion, error) {
+	files, err := extractBundle(data)
+	if err != nil {
+		return nil, err
+	}
+	bundleMutex.Lock()
+	defer bundleMutex.Unlock()
+	sum := sha256.Sum256(data)
+	for attempt := 1; ; attempt++ {
+		versions, err := listBundleVersions(clientset, name)
+		if err != nil {
+			return nil, fmt.Errorf("listing bundle versions: %v", err)
+		}
+		next := 1
+		if len(versions) > 0 {
+			last := versions[len(versions)-1]
+			if last.Course != course {
+				return nil, fmt.Errorf("bundle %s belongs to course %s", name, last.Course)
+			}
+			next = last.Version + 1
+		}
+		secret, err := clientset.CoreV1().Secrets(serverNamespace()).Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: meta.ObjectMeta{
+				Name:        bundleSecretName(name, next),
+				Labels:      map[string]string{bundleLabel: name, bundleVersionLabel: strconv.Itoa(next), bundleCourseLabel: course},
+				Annotations: map[string]string{bundleHashAnnotation: hex.EncodeToString(sum[:])},
+			},
+			Data: map[string][]byte{bundleKey: data},
+		}, meta.CreateOptions{})
+		if errors.IsAlreadyExists(err) && attempt < bundleStoreAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("storing bundle: %v", err)
+		}
+		v := &bundleVersion{Name: name, Version: next, Course: course, SHA256: hex.EncodeToString(sum[:]), Uploaded: secret.CreationTimestamp.Time}
+		for f := range files {
+			v.Files = append(v.Files, f)
+		}
+		sort.Strings(v.Files)
+		return v, nil
+	}
+}
+
+// currentBundleVersion returns the configured bundle version, or the latest
+// upload when none is pinned.
+func currentBundleVersion(clientset kubernetes.Interface, cfg *BundleConfig) (int, error) {
+	if cfg.Version != 0 {
+		return cfg.Version, nil
+	}
+	versions, err := listBundleVersions(clientset, cfg.Name)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, fmt.Errorf("test bundle %s has not been uploaded", cfg.Name)
+	}
+	return versions[len(versions)-1].Version, nil
+}
+
+// checkBundleCourse refuses a test bundle that was uploaded for another
+// course, so an assignment cannot mount someone else's hidden tests. A bundle
+// that has not been uploaded yet is allowed; loadBundle checks it again.
+func checkBundleCourse(clientset kubernetes.Interface, cfg *BundleConfig, course string) error {
+	versions, err := listBundleVersions(clientset, cfg.Name)
+	if err != nil {
+		return fmt.Errorf("listing bundle versions: %v", err)
+	}
+	if len(versions) > 0 && versions[len(versions)-1].Course != course {
+		return fmt.Errorf("test bundle %s belongs to another course", cfg.Name)
+	}
+	return nil
+}
+
+// loadBundle returns the files of the configured bundle version (the latest
+// when none is pinned) and the version number. The bundle must belong to
+// course.
+func loadBundle(clientset kubernetes.Interface, cfg *BundleConfig, course string) (map[string][]byte, int, error) {
+	version, err := currentBundleVersion(clientset, cfg)
+	if err != nil {
+		return nil, 0, err
+	}
+	secret, err := clientset.CoreV1().Secrets(serverNamespace()).Get(context.TODO(), bundleSecretName(cfg.Name, version), meta.GetOptions{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("test bundle %s v%d: %v", cfg.Name, version, err)
+	}
+	if owner := secret.Labels[bundleCourseLabel]; owner != course {
+		return nil, 0, fmt.Errorf("test bundle %s v%d belongs to course %s, not %s", cfg.Name, version, owner, course)
+	}
+	files, err := extractBundle(secret.Data[bundleKey])
+	if err != nil {
+		return nil, 0, fmt.Errorf("test bundle %s v%d: %v", cfg.Name, version, err)
+	}
+	return files, version, nil
+}
+
+// mountBundle adds the job's copy of the test bundle to the runner container.
+func mountBundle(spec *corev1.PodSpec, secretName string, items []corev1.KeyToPath, mountPath string) {
+	if mountPath == "" {
+		mountPath = "/tests"
+	}
+	mode := int32(0444)
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: "tests-volume",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: secretName, Items: items, DefaultMode: &mode},
+		},
+	})
+	runner := &spec.Containers[0]
+	runner.VolumeMounts = append(runner.VolumeMounts, corev1.VolumeMount{
+		Name:      "tests-volume",
+		MountPath: mountPath,
+		ReadOnly:  true,
+	})
+	runner.Env = append(runner.Env, corev1.EnvVar{Name: "TESTS_DIR", Value: mountPath})
+}
+
+// bundlesHandler serves /admin/bundles/{name}: POST uploads a new version
+// (multipart fields "bundle", a zip, and "course"), GET lists the stored
+// versions. Both need the manage permission on the bundle's course.
+func bundlesHandler(clientset kubernetes.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/admin/bundles/")
+		if name == "" || sanitizeK8sName(name) != name {
+			http.Error(w, "Invalid bundle name", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			versions, err := listBundleVersions(clientset, name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if len(versions) == 0 {
+				http.Error(w, "No such bundle", http.StatusNotFound)
+				return
+			}
+			if !allowed(w, r, permManage, versions[len(versions)-1].Course) {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(versions)
+		case http.MethodPost:
+			if err := r.ParseMultipartForm(10 << 20); err != nil {
+				http.Error(w, "Error parsing form data", http.StatusBadRequest)
+				return
+			}
+			course := r.FormValue("course")
+			if course == "" {
+				http.Error(w, "Missing 'course' field", http.StatusBadRequest)
+				return
+			}
+			if !allowed(w, r, permManage, course) {
+				return
+			}
+			file, _, err := r.FormFile("bundle")
+			if err != nil {
+				http.Error(w, "Missing 'bundle' file", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			data, err := io.ReadAll(file)
+			if err != nil {
+				http.Error(w, "Failed to read bundle file", http.StatusInternalServerError)
+				return
+			}
+			v, err := storeBundle(clientset, name, course, data)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(v)
+		default:
+			http.Error(w, "Only GET and POST methods allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
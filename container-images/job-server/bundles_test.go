@@ -0,0 +1,140 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testBundle(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractBundle(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr bool
+	}{
+		{"plain files", map[string]string{"tests.py": "x", "data/in.txt": "y"}, false},
+		{"empty", map[string]string{}, true},
+		{"parent directory", map[string]string{"../x": "x"}, true},
+		{"spaces", map[string]string{"my tests.py": "x"}, true},
+		{"clashing keys", map[string]string{"a/b": "x", "a-b": "y"}, true},
+	}
+	for _, tt := range tests {
+		_, err := extractBundle(testBundle(t, tt.files))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestStoreBundleConcurrentUploads(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	data := testBundle(t, map[string]string{"tests.py": "pass"})
+	const uploads = 8
+	var wg sync.WaitGroup
+	versions := make([]int, uploads)
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := storeBundle(clientset, "pa1", "cse160", data)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			versions[i] = v.Version
+		}(i)
+	}
+	wg.Wait()
+	sort.Ints(versions)
+	for i, v := range versions {
+		if v != i+1 {
+			t.Fatalf("versions %v, want 1..%d each once", versions, uploads)
+		}
+	}
+}
+
+func TestStoreBundleRetriesOnConflict(t *testing.T) {
+	// Another replica stores version 2 between our list and create.
+	clientset := fake.NewSimpleClientset()
+	data := testBundle(t, map[string]string{"tests.py": "pass"})
+	if _, err := storeBundle(clientset, "pa1", "cse160", data); err != nil {
+		t.Fatal(err)
+	}
+	raced := false
+	clientset.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if raced {
+			return false, nil, nil
+		}
+		raced = true
+		other := &corev1.Secret{ObjectMeta: meta.ObjectMeta{
+			Name:      bundleSecretName("pa1", 2),
+			Namespace: serverNamespace(),
+			Labels:    map[string]string{bundleLabel: "pa1", bundleVersionLabel: "2", bundleCourseLabel: "cse160"},
+		}}
+		err := clientset.Tracker().Add(other)
+		return false, nil, err
+	})
+	v, err := storeBundle(clientset, "pa1", "cse160", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != 3 {
+		t.Errorf("stored version %d, want 3 after losing the race for 2", v.Version)
+	}
+	if _, err := clientset.CoreV1().Secrets(serverNamespace()).Get(context.TODO(), bundleSecretName("pa1", 3), meta.GetOptions{}); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := storeBundle(clientset, "pa1", "cse120", data); err == nil {
+		t.Error("another course overwrote the bundle")
+	}
+}
+
+func TestBundleBelongsToCourse(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	if _, err := storeBundle(clientset, "pa1-tests", "cse160", testBundle(t, map[string]string{"tests.py": "pass"})); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &BundleConfig{Name: "pa1-tests"}
+	if err := checkBundleCourse(clientset, cfg, "cse160"); err != nil {
+		t.Errorf("owning course: %v", err)
+	}
+	if err := checkBundleCourse(clientset, cfg, "cse260"); err == nil {
+		t.Error("another course may use the bundle")
+	}
+	if err := checkBundleCourse(clientset, &BundleConfig{Name: "not-uploaded"}, "cse260"); err != nil {
+		t.Errorf("bundle not uploaded yet: %v", err)
+	}
+	if files, version, err := loadBundle(clientset, cfg, "cse160"); err != nil || version != 1 || len(files) != 1 {
+		t.Errorf("loadBundle = %v, %d, %v", files, version, err)
+	}
+	if _, _, err := loadBundle(clientset, cfg, "cse260"); err == nil {
+		t.Error("another course loaded the bundle")
+	}
+}
@@ -0,0 +1,68 @@
+// rawcompare checks a student's .raw output against the expected .raw file
+// and prints a single Gradescope test entry as JSON on stdout.
+//
+//	rawcompare -expected Dataset/3/output.raw -actual out.raw -name "Dataset 3" -points 2
+//
+// The exit code is 0 when the outputs match, 1 when they do not (or the
+// student output is missing/unreadable) and 2 on usage errors.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"greengrader/webserver/gradescope"
+	"greengrader/webserver/rawcmp"
+)
+
+func main() {
+	expectedPath := flag.String("expected", "", "path to the expected .raw file")
+	actualPath := flag.String("actual", "", "path to the student's .raw output")
+	abs := flag.Float64("abs", 0, "absolute tolerance")
+	rel := flag.Float64("rel", 0, "relative tolerance")
+	maxReport := flag.Int("max-report", 10, "number of mismatches to list in the output")
+	name := flag.String("name", "", "test name (defaults to the expected file path)")
+	points := flag.Float64("points", 1, "points awarded when the outputs match")
+	visibility := flag.String("visibility", "", "Gradescope visibility of the test entry")
+	flag.Parse()
+
+	if *expectedPath == "" || *actualPath == "" {
+		fmt.Fprintln(os.Stderr, "rawcompare: -expected and -actual are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *name == "" {
+		*name = *expectedPath
+	}
+
+	expected, err := rawcmp.ReadFile(*expectedPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rawcompare: reading expected output: %v\n", err)
+		os.Exit(2)
+	}
+
+	var test gradescope.Test
+	actual, err := rawcmp.ReadFile(*actualPath)
+	if err != nil {
+		test = gradescope.Test{
+			Name:     *name,
+			MaxScore: *points,
+			Status:   gradescope.Failed,
+			Output:   fmt.Sprintf("Could not read your output: %v", err),
+		}
+	} else {
+		report := rawcmp.Compare(expected, actual, rawcmp.Tolerance{Abs: *abs, Rel: *rel}, *maxReport)
+		test = report.Test(*name, *points)
+	}
+	test.Visibility = *visibility
+
+	if err := json.NewEncoder(os.Stdout).Encode(test); err != nil {
+		fmt.Fprintf(os.Stderr, "rawcompare: %v\n", err)
+		os.Exit(2)
+	}
+	if test.Status != gradescope.Passed {
+		os.Exit(1)
+	}
+}
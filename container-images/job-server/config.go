@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// configFile persists courses and assignments managed through the admin API.
+// Without it the built-in tables in assignments.go and tenants.go are used.
+const configFile = "/app/config_state.json"
+
+// ConfigMeta is kept by the server on every course and assignment.
+type ConfigMeta struct {
+	Version  int       `json:"version"`
+	Updated  time.Time `json:"updated,omitempty"`
+	Archived bool      `json:"archived,omitempty"` // archived entries accept no submissions
+}
+
+func (m *ConfigMeta) configMeta() *ConfigMeta { return m }
+
+// configRevision is one entry of the change history.
+type configRevision struct {
+	Kind    string          `json:"kind"` // "course" or "assignment"
+	Name    string          `json:"name"`
+	Version int             `json:"version"`
+	Action  string          `json:"action"` // "created", "updated" or "archived"
+	Time    time.Time       `json:"time"`
+	Object  json.RawMessage `json:"object"`
+}
+
+type configState struct {
+	Courses     map[string]*Tenant     `json:"courses"`
+	Assignments map[string]*Assignment `json:"assignments"`
+	History     []configRevision       `json:"history"`
+}
+
+// configMutex guards the assignments and tenants tables and configHistory.
+// Entries are never modified once stored; changes replace them, so the
+// pointers handed out by the lookups stay consistent.
+var (
+	configMutex   sync.RWMutex
+	configHistory []configRevision
+)
+
+func init() {
+	for _, a := range assignments {
+		a.Version = 1
+	}
+	for _, t := range tenants {
+		t.Version = 1
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return
+	}
+	var st configState
+	if err := json.Unmarshal(data, &st); err != nil {
+		log.Printf("Ignoring unreadable %s: %v", configFile, err)
+		return
+	}
+	assignments, tenants, configHistory = st.Assignments, st.Courses, st.History
+	if assignments == nil {
+		assignments = map[string]*Assignment{}
+	}
+	if tenants == nil {
+		tenants = map[string]*Tenant{}
+	}
+}
+
+// saveConfig writes the tables and history to configFile; configMutex must be held.
+func saveConfig() error {
+	data, err := json.MarshalIndent(configState{Courses: tenants, Assignments: assignments, History: configHistory}, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(configFile), "config_tmp_*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	file.Close()
+	if err := os.Rename(file.Name(), configFile); err != nil { // atomic replace
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+// tenantSnapshot returns the configured tenants sorted by name.
+func tenantSnapshot() []*Tenant {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	list := make([]*Tenant, 0, len(tenants))
+	for _, t := range tenants {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// validate checks a course before it is stored.
+func (t *Tenant) validate() error {
+	if t.Name == "" || sanitizeK8sName(t.Name) != t.Name {
+		return fmt.Errorf("name must be lowercase letters, digits, '-' and '.'")
+	}
+	if t.Weight < 0 || t.MinSlots < 0 {
+		return fmt.Errorf("weight and min_slots must not be negative")
+	}
+	if t.Namespace != "" && (sanitizeK8sName(t.Namespace) != t.Namespace || strings.Contains(t.Namespace, ".") || len(t.Namespace) > 63) {
+		return fmt.Errorf("namespace %q is not a valid namespace name", t.Namespace)
+	}
+	if _, err := resourceList(t.Quota); err != nil {
+		return fmt.Errorf("quota: %v", err)
+	}
+	if _, err := t.DefaultResources.requirements(); err != nil {
+		return fmt.Errorf("default_resources: %v", err)
+	}
+	switch t.UnknownSubmitters {
+	case "", unknownAccept, unknownFlag, unknownReject:
+	default:
+		return fmt.Errorf("unknown_submitters must be accept, flag or reject")
+	}
+	return nil
+}
+
+// validate checks an assignment before it is stored; configMutex must be held.
+func (a *Assignment) validate() error {
+	if a.Name == "" || sanitizeK8sName(a.Name) != a.Name {
+		return fmt.Errorf("name must be lowercase letters, digits, '-' and '.'")
+	}
+	if a.Image == "" || len(a.Command) == 0 {
+		return fmt.Errorf("image and command are required")
+	}
+	if a.Tenant != "" && a.Tenant != defaultTenantName {
+		if t, ok := tenants[a.Tenant]; !ok || t.Archived {
+			return fmt.Errorf("unknown course %q", a.Tenant)
+		}
+	}
+	if _, err := a.Resources.requirements(); err != nil {
+		return fmt.Errorf("resources: %v", err)
+	}
+	if a.OpenCL < 0 {
+		return fmt.Errorf("opencl must not be negative")
+	}
+	if _, err := lookupSecurityProfile(a.Security); err != nil {
+		return err
+	}
+	switch a.ResultFormat {
+	case formatAuto, formatGradescope, formatJUnit, formatTAP:
+	default:
+		return fmt.Errorf("unknown result_format %q", a.ResultFormat)
+	}
+	if p := a.Scoring; p != nil {
+		for _, r := range p.Rules {
+			if r.Pattern == "" {
+				return fmt.Errorf("scoring rules need a pattern")
+			}
+		}
+		if p.PenaltyPerDay < 0 || p.MaxPenalty < 0 || p.MaxPenalty > 1 || p.GracePeriod < 0 {
+			return fmt.Errorf("scoring: penalties must be fractions between 0 and 1 and grace_period not negative")
+		}
+	}
+	if a.Benchmark != nil && a.Benchmark.TimedCommand == "" {
+		return fmt.Errorf("benchmark needs a timed_command")
+	}
+	if a.Benchmark != nil && a.CacheResults {
+		return fmt.Errorf("benchmark assignments cannot cache results")
+	}
+	if a.CacheResults && pinnedDigest(a.Image) == "" {
+		return fmt.Errorf("cache_results needs the image pinned by digest (image@sha256:...)")
+	}
+	if a.Archive != nil && (a.Archive.MaxBytes < 0 || a.Archive.MaxEntries < 0) {
+		return fmt.Errorf("archive limits must not be negative")
+	}
+	for i := range a.Prechecks {
+		if err := a.Prechecks[i].validate(); err != nil {
+			return err
+		}
+	}
+	if a.TestBundle != nil && a.TestBundle.Name == "" {
+		return fmt.Errorf("test_bundle needs a name")
+	}
+	if a.Dataset != nil {
+		if _, ok := datasetGenerators[a.Dataset.Generator]; !ok {
+			return fmt.Errorf("unknown dataset generator %q", a.Dataset.Generator)
+		}
+		if !datasetSecretSet() {
+			return fmt.Errorf("datasets need DATASET_SECRET to be set")
+		}
+	}
+	return nil
+}
+
+// configEntry is implemented by *Tenant and *Assignment.
+type configEntry interface {
+	configMeta() *ConfigMeta
+	validate() error
+}
+
+// configHandler serves the admin API for one kind of entry:
+//
+//	GET    /admin/<kind>s               list
+//	POST   /admin/<kind>s               create
+//	GET    /admin/<kind>s/{name}        show
+//	PUT    /admin/<kind>s/{name}        replace, bumping the version
+//	DELETE /admin/<kind>s/{name}        archive
+//	GET    /admin/<kind>s/{name}/history
+//
+// Reading needs readPerm and changing writePerm on the entry's course
+// (courseOf); listings only include entries the caller may read. check, if
+// set, validates a created or replaced entry against the cluster before the
+// lock is taken. changed is called with each stored entry after the lock is
+// released.
+func configHandler[T any, P interface {
+	*T
+	configEntry
+}](kind string, table *map[string]P, nameOf, courseOf func(P) string, readPerm, writePerm string, check func(P) error, changed func(P)) http.HandlerFunc {
+	prefix := "/admin/" + kind + "s"
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := principalFrom(r)
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+		name, sub, _ := strings.Cut(rest, "/")
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case name == "" && r.Method == http.MethodGet:
+			configMutex.RLock()
+			list := make([]P, 0, len(*table))
+			for _, e := range *table {
+				if p.can(readPerm, courseOf(e)) {
+					list = append(list, e)
+				}
+			}
+			configMutex.RUnlock()
+			sort.Slice(list, func(i, j int) bool { return nameOf(list[i]) < nameOf(list[j]) })
+			json.NewEncoder(w).Encode(list)
+			return
+
+		case name != "" && sub == "history" && r.Method == http.MethodGet:
+			configMutex.RLock()
+			e, ok := (*table)[name]
+			if !ok || !p.can(readPerm, courseOf(e)) {
+				configMutex.RUnlock()
+				http.Error(w, "No such "+kind, http.StatusNotFound)
+				return
+			}
+			revisions := []configRevision{}
+			for _, rev := range configHistory {
+				if rev.Kind == kind && rev.Name == name {
+					revisions = append(revisions, rev)
+				}
+			}
+			configMutex.RUnlock()
+			json.NewEncoder(w).Encode(revisions)
+			return
+
+		case name != "" && sub == "" && r.Method == http.MethodGet:
+			configMutex.RLock()
+			e, ok := (*table)[name]
+			configMutex.RUnlock()
+			if !ok || !p.can(readPerm, courseOf(e)) {
+				http.Error(w, "No such "+kind, http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(e)
+			return
+		}
+
+		var entry P
+		action := ""
+		status := http.StatusOK
+		switch {
+		case name == "" && r.Method == http.MethodPost, name != "" && sub == "" && r.Method == http.MethodPut:
+			entry = new(T)
+			if err := json.NewDecoder(r.Body).Decode(entry); err != nil {
+				http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if name != "" && nameOf(entry) != name {
+				http.Error(w, "The name in the body does not match the URL", http.StatusBadRequest)
+				return
+			}
+			action = "updated"
+			if r.Method == http.MethodPost {
+				action, status = "created", http.StatusCreated
+			}
+		case name != "" && sub == "" && r.Method == http.MethodDelete:
+			action = "archived"
+		default:
+			http.Error(w, "Unsupported method or path", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if check != nil && entry != nil && p.can(writePerm, courseOf(entry)) {
+			if err := check(entry); err != nil {
+				http.Error(w, "Invalid "+kind+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		configMutex.Lock()
+		if entry == nil {
+			old, ok := (*table)[name]
+			if !ok {
+				configMutex.Unlock()
+				http.Error(w, "No such "+kind, http.StatusNotFound)
+				return
+			}
+			copied := *(*T)(old)
+			entry = &copied
+			entry.configMeta().Archived = true
+		}
+		key := nameOf(entry)
+		old, exists := (*table)[key]
+		if action == "created" && exists {
+			configMutex.Unlock()
+			http.Error(w, kind+" "+key+" already exists", http.StatusConflict)
+			return
+		}
+		if action == "updated" && !exists {
+			configMutex.Unlock()
+			http.Error(w, "No such "+kind, http.StatusNotFound)
+			return
+		}
+		if !p.can(writePerm, courseOf(entry)) || exists && !p.can(writePerm, courseOf(old)) {
+			configMutex.Unlock()
+			http.Error(w, "Not allowed", http.StatusForbidden)
+			return
+		}
+		if err := entry.validate(); err != nil {
+			configMutex.Unlock()
+			http.Error(w, "Invalid "+kind+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		m := entry.configMeta()
+		m.Version, m.Updated = 1, time.Now()
+		if exists {
+			m.Version = old.configMeta().Version + 1
+		}
+		snapshot, _ := json.Marshal(entry)
+		(*table)[key] = entry
+		configHistory = append(configHistory, configRevision{
+			Kind: kind, Name: key, Version: m.Version, Action: action, Time: m.Updated, Object: snapshot,
+		})
+		if err := saveConfig(); err != nil {
+			// Undo the change so memory never runs ahead of what a restart loads.
+			if exists {
+				(*table)[key] = old
+			} else {
+				delete(*table, key)
+			}
+			configHistory = configHistory[:len(configHistory)-1]
+			configMutex.Unlock()
+			log.Printf("Saving %s: %v", configFile, err)
+			http.Error(w, "Could not save the change", http.StatusInternalServerError)
+			return
+		}
+		configMutex.Unlock()
+
+		if changed != nil {
+			changed(entry)
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(entry)
+	}
+}
+
+// registerConfigHandlers installs the course and assignment admin endpoints.
+// Only admins change courses; instructors manage their courses' assignments
+// and TAs can read them. Course changes re-provision the course namespace.
+func registerConfigHandlers(clientset kubernetes.Interface) {
+	courseName := func(t *Tenant) string { return t.Name }
+	courses := configHandler("course", &tenants, courseName, courseName, permViewJobs, permAdmin, nil, func(t *Tenant) {
+		if t.Namespace != "" && !t.Archived {
+			if err := provisionNamespace(clientset, t); err != nil {
+				log.Printf("Provisioning namespace %s for %s: %v", t.Namespace, t.Name, err)
+			}
+		}
+	})
+	http.HandleFunc("/admin/courses", authenticated(courses))
+	http.HandleFunc("/admin/courses/", authenticated(courses))
+
+	checkAssignment := func(a *Assignment) error {
+		if a.TestBundle == nil || a.TestBundle.Name == "" {
+			return nil
+		}
+		return checkBundleCourse(clientset, a.TestBundle, a.tenant())
+	}
+	assignmentsAPI := configHandler("assignment", &assignments, func(a *Assignment) string { return a.Name },
+		(*Assignment).tenant, permViewJobs, permManage, checkAssignment, nil)
+	http.HandleFunc("/admin/assignments", authenticated(assignmentsAPI))
+	http.HandleFunc("/admin/assignments/", authenticated(assignmentsAPI))
+}
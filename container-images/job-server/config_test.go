@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConfigSaveFailureRollsBack(t *testing.T) {
+	blockFile(t, configFile)
+
+	configMutex.Lock()
+	saved, savedHistory := assignments, configHistory
+	assignments = map[string]*Assignment{"kept": {Name: "kept", Image: "busybox", Command: []string{"true"}, ConfigMeta: ConfigMeta{Version: 1}}}
+	configHistory = nil
+	configMutex.Unlock()
+	t.Cleanup(func() {
+		configMutex.Lock()
+		assignments, configHistory = saved, savedHistory
+		configMutex.Unlock()
+	})
+
+	t.Setenv("ADMIN_TOKEN", "test-admin")
+	handler := authenticated(configHandler("assignment", &assignments, func(a *Assignment) string { return a.Name },
+		(*Assignment).tenant, permViewJobs, permManage, nil, nil))
+	tests := []struct {
+		method, path string
+		body         *Assignment
+	}{
+		{http.MethodPost, "/admin/assignments", &Assignment{Name: "added", Image: "busybox", Command: []string{"true"}}},
+		{http.MethodPut, "/admin/assignments/kept", &Assignment{Name: "kept", Image: "alpine", Command: []string{"true"}}},
+		{http.MethodDelete, "/admin/assignments/kept", nil},
+	}
+	for _, tt := range tests {
+		var body bytes.Buffer
+		if tt.body != nil {
+			json.NewEncoder(&body).Encode(tt.body)
+		}
+		req := httptest.NewRequest(tt.method, tt.path, &body)
+		req.Header.Set("Authorization", "Bearer test-admin")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("%s %s: status %d, want 500", tt.method, tt.path, rec.Code)
+		}
+	}
+
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	if len(assignments) != 1 || assignments["kept"].Image != "busybox" || assignments["kept"].Archived || assignments["kept"].Version != 1 {
+		t.Errorf("failed saves changed the table: %+v", assignments)
+	}
+	if len(configHistory) != 0 {
+		t.Errorf("failed saves left history entries: %+v", configHistory)
+	}
+}
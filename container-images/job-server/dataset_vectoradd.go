@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+
+	"greengrader/webserver/rawcmp"
+)
+
+// vectorAddGenerator mirrors Dataset/dataset_generator.py: each dataset folder
+// holds `arrays` random integer vectors input0..inputN-1.raw and their
+// element-wise sum in output.raw.
+//
+// Params:
+//
+//	arrays  number of input vectors per dataset (default 4)
+//	sizes   comma separated vector length of each dataset folder (default 1,16,256,4096)
+//	max     largest random value (default 100)
+type vectorAddGenerator struct{}
+
+func init() {
+	registerDatasetGenerator("vector_add", vectorAddGenerator{})
+}
+
+func (vectorAddGenerator) Generate(seed int64, params map[string]string) (map[string][]byte, error) {
+	arrays, err := intParam(params, "arrays", 4)
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := intListParam(params, "sizes", []int{1, 16, 256, 4096})
+	if err != nil {
+		return nil, err
+	}
+	maxValue, err := intParam(params, "max", 100)
+	if err != nil {
+		return nil, err
+	}
+	if arrays < 1 {
+		return nil, fmt.Errorf("vector_add needs at least one input array")
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	files := make(map[string][]byte)
+	for d, n := range sizes {
+		sum := make([]float64, n)
+		for i := 0; i < arrays; i++ {
+			values := make([]float64, n)
+			for j := range values {
+				values[j] = float64(rng.Intn(maxValue + 1))
+				sum[j] += values[j]
+			}
+			if err := addRawFile(files, fmt.Sprintf("%d/input%d.raw", d, i), rawcmp.NewVector(values)); err != nil {
+				return nil, err
+			}
+		}
+		if err := addRawFile(files, fmt.Sprintf("%d/output.raw", d), rawcmp.NewVector(sum)); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func addRawFile(files map[string][]byte, path string, m *rawcmp.Matrix) error {
+	var buf bytes.Buffer
+	if err := rawcmp.Write(&buf, m); err != nil {
+		return err
+	}
+	files[path] = buf.Bytes()
+	return nil
+}
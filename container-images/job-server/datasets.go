@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DatasetConfig selects a dataset generator for an assignment.
+type DatasetConfig struct {
+	Generator string            `json:"generator,omitempty"`  // name a DatasetGenerator registered itself under
+	MountPath string            `json:"mount_path,omitempty"` // where the files appear in the runner, exported as $DATASET_DIR
+	Params    map[string]string `json:"params,omitempty"`     // generator specific settings
+}
+
+// DatasetGenerator produces the inputs and expected outputs for one submission.
+// Files are keyed by their path relative to the dataset root, e.g. "3/input0.raw".
+// The same seed and params must always produce the same files.
+type DatasetGenerator interface {
+	Generate(seed int64, params map[string]string) (map[string][]byte, error)
+}
+
+var datasetGenerators = map[string]DatasetGenerator{}
+
+// registerDatasetGenerator is called from the init() of each generator file.
+func registerDatasetGenerator(name string, g DatasetGenerator) {
+	if _, dup := datasetGenerators[name]; dup {
+		panic("dataset generator registered twice: " + name)
+	}
+	datasetGenerators[name] = g
+}
+
+// maxDatasetBytes keeps generated datasets under the 1MiB ConfigMap limit.
+const maxDatasetBytes = 1000 * 1024
+
+// datasetSecretSet reports whether DATASET_SECRET is configured. Without it
+// every seed would be predictable, so dataset assignments are refused.
+func datasetSecretSet() bool {
+	return os.Getenv("DATASET_SECRET") != ""
+}
+
+// datasetSeed derives a per-student, per-assignment seed. DATASET_SECRET is
+// mixed in so students cannot compute each other's datasets.
+func datasetSeed(student, assignment string) int64 {
+	sum := sha256.Sum256([]byte(os.Getenv("DATASET_SECRET") + "\x00" + student + "\x00" + assignment))
+	return int64(binary.BigEndian.Uint64(sum[:8]) &^ (1 << 63))
+}
+
+// generateDataset runs the assignment's generator for the given seed.
+func generateDataset(cfg *DatasetConfig, seed int64) (map[string][]byte, error) {
+	g, ok := datasetGenerators[cfg.Generator]
+	if !ok {
+		return nil, fmt.Errorf("unknown dataset generator %q", cfg.Generator)
+	}
+	files, err := g.Generate(seed, cfg.Params)
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	for _, data := range files {
+		total += len(data)
+	}
+	if total > maxDatasetBytes {
+		return nil, fmt.Errorf("generated dataset is %d bytes, over the %d byte ConfigMap limit", total, maxDatasetBytes)
+	}
+	return files, nil
+}
+
+// datasetVolumeItems maps dataset paths onto ConfigMap keys. Keys cannot
+// contain '/', so "3/input0.raw" is stored as "3-input0.raw" and projected
+// back to its path when mounted.
+func datasetVolumeItems(files map[string][]byte) (map[string][]byte, []corev1.KeyToPath) {
+	data := make(map[string][]byte, len(files))
+	items := make([]corev1.KeyToPath, 0, len(files))
+	for path, contents := range files {
+		key := strings.ReplaceAll(path, "/", "-")
+		data[key] = contents
+		items = append(items, corev1.KeyToPath{Key: key, Path: path})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+	return data, items
+}
+
+func intParam(params map[string]string, key string, def int) (int, error) {
+	v, ok := params[key]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("param %s: %w", key, err)
+	}
+	return n, nil
+}
+
+func intListParam(params map[string]string, key string, def []int) ([]int, error) {
+	v, ok := params[key]
+	if !ok {
+		return def, nil
+	}
+	var out []int
+	for _, s := range strings.Split(v, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("param %s: %w", key, err)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"greengrader/webserver/rawcmp"
+)
+
+func TestPA2Dataset(t *testing.T) {
+	cfg := assignments["pa2"].Dataset
+	files, err := generateDataset(cfg, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The PA2 Makefile runs Dataset/0 through Dataset/9.
+	for d := 0; d <= 9; d++ {
+		var inputs []*rawcmp.Matrix
+		for i := 0; i < 4; i++ {
+			m, err := rawcmp.Read(bytes.NewReader(files[fmt.Sprintf("%d/input%d.raw", d, i)]))
+			if err != nil {
+				t.Fatalf("folder %d input %d: %v", d, i, err)
+			}
+			inputs = append(inputs, m)
+		}
+		out, err := rawcmp.Read(bytes.NewReader(files[fmt.Sprintf("%d/output.raw", d)]))
+		if err != nil {
+			t.Fatalf("folder %d output: %v", d, err)
+		}
+		for j, got := range out.Data {
+			want := 0.0
+			for _, in := range inputs {
+				want += in.Data[j]
+			}
+			if got != want {
+				t.Fatalf("folder %d: output[%d] = %g, want %g", d, j, got, want)
+			}
+		}
+	}
+	if _, ok := files["10/output.raw"]; ok {
+		t.Error("generated a folder the Makefile never runs")
+	}
+
+	again, err := generateDataset(cfg, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(files["9/input0.raw"], again["9/input0.raw"]) {
+		t.Error("the same seed produced different datasets")
+	}
+	other, err := generateDataset(cfg, 43)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(files["9/input0.raw"], other["9/input0.raw"]) {
+		t.Error("different seeds produced the same dataset")
+	}
+}
+
+func TestDatasetNeedsSecret(t *testing.T) {
+	a := *assignments["pa2"]
+	t.Setenv("DATASET_SECRET", "")
+	if err := a.validate(); err == nil || !strings.Contains(err.Error(), "DATASET_SECRET") {
+		t.Errorf("validate without DATASET_SECRET = %v, want an error naming it", err)
+	}
+	t.Setenv("DATASET_SECRET", "s3cret")
+	if err := a.validate(); err != nil {
+		t.Errorf("validate with DATASET_SECRET = %v", err)
+	}
+	seed := datasetSeed("alice", "pa2")
+	t.Setenv("DATASET_SECRET", "other")
+	if datasetSeed("alice", "pa2") == seed {
+		t.Error("the seed does not depend on DATASET_SECRET")
+	}
+}
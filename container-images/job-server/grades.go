@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"greengrader/webserver/gradescope"
+)
+
+// gradeRow is one student's grade for an assignment: the score of their
+// latest successful submission, which for group submissions is credited to
+// every member.
+type gradeRow struct {
+	Student     string                        `json:"student"`
+	JobID       string                        `json:"job_id"`
+	Group       []string                      `json:"group,omitempty"` // all members when it was a group submission
+	Submitted   time.Time                     `json:"submitted"`
+	Score       float64                       `json:"score"`
+	MaxScore    float64                       `json:"max_score,omitempty"`
+	Leaderboard []gradescope.LeaderboardEntry `json:"leaderboard,omitempty"`
+}
+
+// assignmentGrades returns a row per student with a successful submission to
+// the assignment, sorted by student. A regrade run stands in for the
+// submission it regraded; the most recently finished run wins.
+func assignmentGrades(assignment string) []gradeRow {
+	// submitted is when the student handed the work in; jobStoreMutex must be held.
+	submitted := func(rec *JobRecord) time.Time {
+		if orig, ok := jobStore[rec.RegradeOf]; ok {
+			return orig.Submitted
+		}
+		return rec.Submitted
+	}
+	latest := map[string]*JobRecord{}
+	jobStoreMutex.Lock()
+	for _, rec := range jobStore {
+		if rec.Assignment != assignment || rec.Status != statusSucceeded && rec.Status != statusCached {
+			continue
+		}
+		for _, s := range rec.members() {
+			prev, ok := latest[s]
+			if !ok || submitted(rec).After(submitted(prev)) ||
+				submitted(rec).Equal(submitted(prev)) && rec.Finished.After(prev.Finished) {
+				latest[s] = rec
+			}
+		}
+	}
+	rows := make([]gradeRow, 0, len(latest))
+	for student, rec := range latest {
+		row := gradeRow{Student: student, JobID: rec.ID, Submitted: submitted(rec)}
+		if len(rec.Students) > 1 {
+			row.Group = rec.Students
+		}
+		var res gradescope.Results
+		if json.Unmarshal(rec.Results, &res) == nil {
+			row.Score, row.MaxScore, row.Leaderboard = res.TotalScore(), res.MaxScore(), res.Leaderboard
+		}
+		rows = append(rows, row)
+	}
+	jobStoreMutex.Unlock()
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Student < rows[j].Student })
+	return rows
+}
+
+// resultScore returns the total score of a results.json, or nil if it has none.
+func resultScore(results []byte) *float64 {
+	var res gradescope.Results
+	if len(results) == 0 || json.Unmarshal(results, &res) != nil {
+		return nil
+	}
+	score := res.TotalScore()
+	return &score
+}
+
+// gradesHandler serves GET /grades/{assignment} to course staff as JSON, or
+// as CSV with ?format=csv. With ?leaderboard=true only students whose results
+// carry leaderboard entries are listed.
+func gradesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	assignment := strings.Trim(strings.TrimPrefix(r.URL.Path, "/grades/"), "/")
+	if assignment == "" {
+		http.Error(w, "Missing assignment in URL path, e.g., /grades/pa2", http.StatusBadRequest)
+		return
+	}
+	if !allowed(w, r, permViewJobs, lookupAssignment(assignment).tenant()) {
+		return
+	}
+	rows := assignmentGrades(assignment)
+	if r.URL.Query().Get("leaderboard") == "true" {
+		kept := rows[:0]
+		for _, row := range rows {
+			if len(row.Leaderboard) > 0 {
+				kept = append(kept, row)
+			}
+		}
+		rows = kept
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		out := csv.NewWriter(w)
+		out.Write([]string{"student", "score", "max_score", "submitted", "job_id", "group"})
+		for _, row := range rows {
+			out.Write([]string{
+				row.Student,
+				strconv.FormatFloat(row.Score, 'f', -1, 64),
+				strconv.FormatFloat(row.MaxScore, 'f', -1, 64),
+				row.Submitted.Format(time.RFC3339),
+				row.JobID,
+				strings.Join(row.Group, " "),
+			})
+		}
+		out.Flush()
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
@@ -0,0 +1,103 @@
+package gradescope
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+type junitSuite struct {
+	Name   string       `xml:"name,attr"`
+	Suites []junitSuite `xml:"testsuite"`
+	Cases  []junitCase  `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failures  []junitDetail `xml:"failure"`
+	Errors    []junitDetail `xml:"error"`
+	Skipped   *junitDetail  `xml:"skipped"`
+	SystemOut string        `xml:"system-out"`
+	SystemErr string        `xml:"system-err"`
+}
+
+type junitDetail struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// ParseJUnit converts a JUnit XML report (a <testsuites> or <testsuite> root)
+// into unweighted test entries: Score and MaxScore are left at zero for the
+// caller to fill in. Skipped cases are neither passed nor failed and keep an
+// empty Status. Anything before the XML declaration or root element, such as
+// build output, is ignored.
+func ParseJUnit(data []byte) ([]Test, error) {
+	start := junitStart(data)
+	if start < 0 {
+		return nil, fmt.Errorf("no JUnit <testsuite> element found")
+	}
+	var root junitSuite
+	if err := xml.Unmarshal(data[start:], &root); err != nil {
+		return nil, fmt.Errorf("parsing JUnit XML: %w", err)
+	}
+	var tests []Test
+	collectJUnit(&root, &tests)
+	return tests, nil
+}
+
+func junitStart(data []byte) int {
+	for _, marker := range []string{"<?xml", "<testsuites", "<testsuite"} {
+		if i := bytes.Index(data, []byte(marker)); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+func collectJUnit(s *junitSuite, tests *[]Test) {
+	for _, c := range s.Cases {
+		name := c.Name
+		if c.Classname != "" {
+			name = c.Classname + "." + c.Name
+		}
+		t := Test{Name: name, Status: Passed}
+
+		var out strings.Builder
+		for _, f := range append(c.Failures, c.Errors...) {
+			t.Status = Failed
+			writeDetail(&out, f)
+		}
+		if c.Skipped != nil {
+			t.Status = ""
+			out.WriteString("Skipped")
+			if c.Skipped.Message != "" {
+				out.WriteString(": " + c.Skipped.Message)
+			}
+			out.WriteString("\n")
+		}
+		if s := strings.TrimSpace(c.SystemOut); s != "" {
+			out.WriteString(s + "\n")
+		}
+		if s := strings.TrimSpace(c.SystemErr); s != "" {
+			out.WriteString(s + "\n")
+		}
+		t.Output = out.String()
+		*tests = append(*tests, t)
+	}
+	for i := range s.Suites {
+		collectJUnit(&s.Suites[i], tests)
+	}
+}
+
+func writeDetail(out *strings.Builder, d junitDetail) {
+	if d.Message != "" {
+		out.WriteString(d.Message + "\n")
+	}
+	if text := strings.TrimSpace(d.Text); text != "" && text != d.Message {
+		out.WriteString(text + "\n")
+	}
+}
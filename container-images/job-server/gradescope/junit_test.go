@@ -0,0 +1,92 @@
+package gradescope
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseJUnit(t *testing.T) {
+	type want struct {
+		name, status, output string
+	}
+	tests := []struct {
+		name    string
+		input   string
+		want    []want
+		wantErr bool
+	}{
+		{
+			name: "single suite",
+			input: `<?xml version="1.0"?>
+<testsuite name="vec">
+  <testcase classname="vec" name="add"/>
+  <testcase classname="vec" name="sub"><failure message="expected 1, got 2">trace</failure></testcase>
+  <testcase name="mul"><error message="segfault"/></testcase>
+</testsuite>`,
+			want: []want{
+				{"vec.add", Passed, ""},
+				{"vec.sub", Failed, "expected 1, got 2\ntrace\n"},
+				{"mul", Failed, "segfault\n"},
+			},
+		},
+		{
+			name: "skipped is neutral",
+			input: `<testsuite name="gpu">
+  <testcase name="opencl"><skipped message="no device"/></testcase>
+  <testcase name="bare"><skipped/></testcase>
+</testsuite>`,
+			want: []want{
+				{"opencl", "", "Skipped: no device\n"},
+				{"bare", "", "Skipped\n"},
+			},
+		},
+		{
+			name: "nested suites after build output",
+			input: `gcc -o solution main.c
+<testsuites>
+  <testsuite name="a"><testcase name="one"><system-out> hello </system-out></testcase></testsuite>
+  <testsuite name="b"><testsuite name="c"><testcase name="two"/></testsuite></testsuite>
+</testsuites>`,
+			want: []want{
+				{"one", Passed, "hello\n"},
+				{"two", Passed, ""},
+			},
+		},
+		{
+			name:    "no report",
+			input:   "make: *** [run] Error 1",
+			wantErr: true,
+		},
+		{
+			name:    "broken xml",
+			input:   `<testsuite name="x"><testcase name="y">`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseJUnit([]byte(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d tests, want %d: %+v", tt.name, len(got), len(tt.want), got)
+			continue
+		}
+		for i, w := range tt.want {
+			if got[i].Name != w.name || got[i].Status != w.status || got[i].Output != w.output {
+				t.Errorf("%s: test %d = %q %q %q, want %q %q %q", tt.name, i,
+					got[i].Name, got[i].Status, got[i].Output, w.name, w.status, w.output)
+			}
+		}
+	}
+}
+
+func TestLooksLikeJUnit(t *testing.T) {
+	if !LooksLikeJUnit([]byte(`<testsuites><testsuite/></testsuites>`)) {
+		t.Error("a <testsuites> report was not recognised")
+	}
+	if LooksLikeJUnit([]byte(strings.Repeat("ok 1\n", 3))) {
+		t.Error("TAP output was taken for JUnit")
+	}
+}
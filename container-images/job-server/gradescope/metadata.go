@@ -0,0 +1,55 @@
+package gradescope
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// User is a submitter as listed in submission_metadata.json. Group
+// submissions list every member.
+type User struct {
+	Email string      `json:"email"`
+	ID    json.Number `json:"id,omitempty"`
+	Name  string      `json:"name"`
+	SID   string      `json:"sid,omitempty"`
+}
+
+// AssignmentInfo describes the Gradescope assignment being submitted to.
+type AssignmentInfo struct {
+	ID              json.Number `json:"id,omitempty"`
+	CourseID        json.Number `json:"course_id,omitempty"`
+	Title           string      `json:"title"`
+	DueDate         time.Time   `json:"due_date"`
+	LateDueDate     time.Time   `json:"late_due_date"`
+	ReleaseDate     time.Time   `json:"release_date"`
+	TotalPoints     json.Number `json:"total_points,omitempty"`
+	GroupSubmission bool        `json:"group_submission"`
+	GroupSize       int         `json:"group_size,omitempty"`
+}
+
+// PreviousSubmission is an earlier submission by the same submitter(s).
+type PreviousSubmission struct {
+	SubmissionTime time.Time       `json:"submission_time"`
+	Score          json.Number     `json:"score,omitempty"`
+	Results        json.RawMessage `json:"results,omitempty"`
+}
+
+// SubmissionMetadata is Gradescope's /autograder/submission_metadata.json.
+type SubmissionMetadata struct {
+	ID                  json.Number          `json:"id,omitempty"`
+	CreatedAt           time.Time            `json:"created_at"`
+	SubmissionMethod    string               `json:"submission_method,omitempty"`
+	Users               []User               `json:"users"`
+	Assignment          AssignmentInfo       `json:"assignment"`
+	PreviousSubmissions []PreviousSubmission `json:"previous_submissions,omitempty"`
+}
+
+// ParseMetadata parses submission_metadata.json.
+func ParseMetadata(data []byte) (*SubmissionMetadata, error) {
+	var m SubmissionMetadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing submission metadata: %w", err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,89 @@
+package gradescope
+
+import (
+	"testing"
+	"time"
+)
+
+// sampleMetadata follows the example in Gradescope's autograder docs.
+const sampleMetadata = `{
+  "id": 123456,
+  "created_at": "2018-07-01T14:22:32.365935-07:00",
+  "assignment": {
+    "due_date": "2018-07-31T23:00:00.000000-07:00",
+    "group_size": 4,
+    "group_submission": true,
+    "id": 25828,
+    "course_id": 1234,
+    "late_due_date": null,
+    "release_date": "2018-07-02T00:00:00.000000-07:00",
+    "title": "Programming Assignment 1",
+    "total_points": "20.0"
+  },
+  "submission_method": "upload",
+  "users": [
+    {"email": "student@example.com", "id": 1234, "name": "Student User", "sid": "A1"},
+    {"email": "partner@example.com", "id": 5678, "name": "Partner User"}
+  ],
+  "previous_submissions": [
+    {
+      "submission_time": "2017-04-06T14:24:48.087023-07:00",
+      "score": 0.0,
+      "results": {"score": 0, "tests": []}
+    }
+  ]
+}`
+
+func TestParseMetadata(t *testing.T) {
+	m, err := ParseMetadata([]byte(sampleMetadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdt := time.FixedZone("PDT", -7*3600)
+	checks := []struct {
+		what      string
+		got, want any
+	}{
+		{"id", m.ID.String(), "123456"},
+		{"created_at", m.CreatedAt.Equal(time.Date(2018, 7, 1, 14, 22, 32, 365935000, pdt)), true},
+		{"submission_method", m.SubmissionMethod, "upload"},
+		{"users", len(m.Users), 2},
+		{"first user", m.Users[0], User{Email: "student@example.com", ID: "1234", Name: "Student User", SID: "A1"}},
+		{"second user sid", m.Users[1].SID, ""},
+		{"title", m.Assignment.Title, "Programming Assignment 1"},
+		{"course_id", m.Assignment.CourseID.String(), "1234"},
+		{"due_date", m.Assignment.DueDate.Equal(time.Date(2018, 7, 31, 23, 0, 0, 0, pdt)), true},
+		{"null late_due_date", m.Assignment.LateDueDate.IsZero(), true},
+		{"group", m.Assignment.GroupSubmission && m.Assignment.GroupSize == 4, true},
+		{"total_points as a string", m.Assignment.TotalPoints.String(), "20.0"},
+		{"previous submissions", len(m.PreviousSubmissions), 1},
+		{"previous score", m.PreviousSubmissions[0].Score.String(), "0.0"},
+		{"previous results", string(m.PreviousSubmissions[0].Results), `{"score": 0, "tests": []}`},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.what, c.got, c.want)
+		}
+	}
+}
+
+func TestParseMetadataErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"not JSON", `users: []`},
+		{"truncated", `{"users": [`},
+		{"bad date", `{"created_at": "yesterday"}`},
+		{"users not a list", `{"users": {"name": "x"}}`},
+		{"id not a number", `{"id": "abc"}`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseMetadata([]byte(tt.input)); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+	if m, err := ParseMetadata([]byte(`{}`)); err != nil || len(m.Users) != 0 || !m.CreatedAt.IsZero() {
+		t.Errorf("empty metadata = %+v, %v", m, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Package gradescope holds the results.json types that Gradescope expects
+// an autograder to write to /autograder/results/results.json.
+package gradescope
+
+// Visibility values accepted by Gradescope for tests and for the whole submission.
+const (
+	Hidden         = "hidden"
+	AfterDueDate   = "after_due_date"
+	AfterPublished = "after_published"
+	Visible        = "visible"
+)
+
+// Test status values. Gradescope derives these from the score when omitted.
+const (
+	Passed = "passed"
+	Failed = "failed"
+)
+
+// Test is a single entry of the "tests" array.
+type Test struct {
+	Name         string         `json:"name,omitempty"`
+	NameFormat   string         `json:"name_format,omitempty"`
+	Number       string         `json:"number,omitempty"`
+	Score        float64        `json:"score"`
+	MaxScore     float64        `json:"max_score,omitempty"`
+	Status       string         `json:"status,omitempty"`
+	Output       string         `json:"output,omitempty"`
+	OutputFormat string         `json:"output_format,omitempty"`
+	Tags         []string       `json:"tags,omitempty"`
+	Visibility   string         `json:"visibility,omitempty"`
+	ExtraData    map[string]any `json:"extra_data,omitempty"`
+}
+
+// LeaderboardEntry is a single entry of the "leaderboard" array.
+type LeaderboardEntry struct {
+	Name  string `json:"name"`
+	Value any    `json:"value"`
+	Order string `json:"order,omitempty"`
+}
+
+// Results is the whole results.json document. Score is a pointer because
+// Gradescope sums the test scores when the top-level score is left out.
+type Results struct {
+	Score            *float64           `json:"score,omitempty"`
+	ExecutionTime    float64            `json:"execution_time,omitempty"`
+	Output           string             `json:"output,omitempty"`
+	OutputFormat     string             `json:"output_format,omitempty"`      // "text", "html", "simple_format", "md" or "ansi"
+	TestOutputFormat string             `json:"test_output_format,omitempty"` // default output_format of the tests
+	TestNameFormat   string             `json:"test_name_format,omitempty"`   // default name_format of the tests
+	Visibility       string             `json:"visibility,omitempty"`
+	StdoutVisibility string             `json:"stdout_visibility,omitempty"`
+	ExtraData        map[string]any     `json:"extra_data,omitempty"`
+	Tests            []Test             `json:"tests,omitempty"`
+	Leaderboard      []LeaderboardEntry `json:"leaderboard,omitempty"`
+}
+
+// TotalScore returns the top-level score if set, otherwise the sum of the test scores.
+func (r *Results) TotalScore() float64 {
+	if r.Score != nil {
+		return *r.Score
+	}
+	total := 0.0
+	for _, t := range r.Tests {
+		total += t.Score
+	}
+	return total
+}
+
+// MaxScore returns the sum of the test max scores.
+func (r *Results) MaxScore() float64 {
+	total := 0.0
+	for _, t := range r.Tests {
+		total += t.MaxScore
+	}
+	return total
+}
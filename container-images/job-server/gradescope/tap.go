@@ -0,0 +1,101 @@
+package gradescope
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	tapPlan   = regexp.MustCompile(`^1\.\.(\d+)`)
+	tapResult = regexp.MustCompile(`^(not )?ok\b\s*(\d+)?\s*(?:-\s*)?(.*)$`)
+)
+
+// ParseTAP converts Test Anything Protocol output into unweighted test
+// entries. Diagnostic ("# ...") and indented YAML lines following a test
+// become that test's output. Tests with a SKIP or TODO directive count
+// neither way and keep an empty Status. Tests promised by the plan but never
+// reported (e.g. after a crash or "Bail out!") are added as failures.
+func ParseTAP(data []byte) ([]Test, error) {
+	var tests []Test
+	planned := -1
+	bailOut := ""
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		raw := sc.Text()
+		line := strings.TrimSpace(raw)
+		switch {
+		case line == "" || strings.HasPrefix(line, "TAP version"):
+		case tapPlan.MatchString(line):
+			n, _ := strconv.Atoi(tapPlan.FindStringSubmatch(line)[1])
+			planned = n
+		case strings.HasPrefix(line, "Bail out!"):
+			bailOut = strings.TrimSpace(strings.TrimPrefix(line, "Bail out!"))
+		case raw == line && tapResult.MatchString(line):
+			m := tapResult.FindStringSubmatch(line)
+			t := Test{Status: Passed}
+			if m[1] != "" {
+				t.Status = Failed
+			}
+			desc, directive, _ := strings.Cut(m[3], "#")
+			t.Name = strings.TrimSpace(desc)
+			if t.Name == "" {
+				t.Name = "test " + strconv.Itoa(len(tests)+1)
+			}
+			if d := strings.TrimSpace(directive); d != "" {
+				t.Output = "# " + d + "\n"
+				if tapSkipOrTodo(d) {
+					t.Status = ""
+				}
+			}
+			tests = append(tests, t)
+		case len(tests) > 0:
+			// diagnostics and YAML blocks belong to the preceding test
+			tests[len(tests)-1].Output += strings.TrimPrefix(line, "# ") + "\n"
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(tests) == 0 && planned < 0 {
+		return nil, fmt.Errorf("no TAP test lines found")
+	}
+	for i := len(tests); i < planned; i++ {
+		out := "Test did not run"
+		if bailOut != "" {
+			out += ": bailed out: " + bailOut
+		}
+		tests = append(tests, Test{Name: "test " + strconv.Itoa(i+1), Status: Failed, Output: out})
+	}
+	return tests, nil
+}
+
+// tapSkipOrTodo reports whether a directive is SKIP or TODO, which TAP
+// matches case-insensitively by prefix ("# skipped: no GPU").
+func tapSkipOrTodo(directive string) bool {
+	d := strings.ToUpper(directive)
+	return strings.HasPrefix(d, "SKIP") || strings.HasPrefix(d, "TODO")
+}
+
+// LooksLikeTAP reports whether data has a TAP plan or version line.
+func LooksLikeTAP(data []byte) bool {
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "TAP version") || tapPlan.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// LooksLikeJUnit reports whether data contains a JUnit <testsuite> element.
+func LooksLikeJUnit(data []byte) bool {
+	return bytes.Contains(data, []byte("<testsuite"))
+}
@@ -0,0 +1,95 @@
+package gradescope
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTAP(t *testing.T) {
+	type want struct {
+		name, status string
+	}
+	tests := []struct {
+		name    string
+		input   string
+		want    []want
+		wantErr bool
+	}{
+		{
+			name:  "pass and fail",
+			input: "TAP version 13\n1..2\nok 1 - adds\nnot ok 2 - subtracts\n",
+			want:  []want{{"adds", Passed}, {"subtracts", Failed}},
+		},
+		{
+			name:  "skip is neutral",
+			input: "1..2\nok 1 - gpu # SKIP no GPU on this node\nok 2 # skipped\n",
+			want:  []want{{"gpu", ""}, {"test 2", ""}},
+		},
+		{
+			name:  "todo is neutral either way",
+			input: "1..2\nnot ok 1 - later # TODO not written yet\nok 2 - bonus # todo\n",
+			want:  []want{{"later", ""}, {"bonus", ""}},
+		},
+		{
+			name:  "other directives are kept as output only",
+			input: "1..1\nnot ok 1 - slow # took 3s\n",
+			want:  []want{{"slow", Failed}},
+		},
+		{
+			name:  "missing tests fail",
+			input: "1..3\nok 1 - first\nBail out! segfault\n",
+			want:  []want{{"first", Passed}, {"test 2", Failed}, {"test 3", Failed}},
+		},
+		{
+			name:  "plan at the end",
+			input: "ok - a\nok - b\n1..2\n",
+			want:  []want{{"a", Passed}, {"b", Passed}},
+		},
+		{
+			name:    "no tests",
+			input:   "make: *** [run] Error 1\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseTAP([]byte(tt.input))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d tests, want %d: %+v", tt.name, len(got), len(tt.want), got)
+			continue
+		}
+		for i, w := range tt.want {
+			if got[i].Name != w.name || got[i].Status != w.status {
+				t.Errorf("%s: test %d = %q %q, want %q %q", tt.name, i, got[i].Name, got[i].Status, w.name, w.status)
+			}
+		}
+	}
+}
+
+func TestParseTAPOutput(t *testing.T) {
+	got, err := ParseTAP([]byte("1..1\nnot ok 1 - sum\n# expected 3\n# got 4\n  ---\n  line: 7\n  ...\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"expected 3", "got 4", "line: 7"} {
+		if !strings.Contains(got[0].Output, s) {
+			t.Errorf("output %q is missing %q", got[0].Output, s)
+		}
+	}
+}
+
+func TestLooksLikeTAP(t *testing.T) {
+	for input, want := range map[string]bool{
+		"TAP version 14\nok 1\n": true,
+		"building...\n1..4\n":    true,
+		"ok 1 - no plan\n":       false,
+		`{"score": 1}`:           false,
+	} {
+		if got := LooksLikeTAP([]byte(input)); got != want {
+			t.Errorf("LooksLikeTAP(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+// Crockford's base32 alphabet, lowercased so IDs are valid Kubernetes names.
+const ulidAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// newULID returns a 26 character ULID: a 48-bit millisecond timestamp
+// followed by 80 random bits, so IDs sort by creation time and do not collide.
+func newULID(t time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(t.UnixMilli())<<16)
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	// 128 bits as 26 groups of 5, the first group holding only the top 3 bits.
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = ulidAlphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// newSubmissionID returns the opaque ID a submission is known by, in the
+// API and in every Kubernetes object created for it: a short hash of the
+// assignment, so one assignment's runs can be told apart in kubectl, and a
+// ULID. Who submitted it is only in the job record.
+func newSubmissionID(assignment string, t time.Time) string {
+	sum := sha256.Sum256([]byte(assignment))
+	return hex.EncodeToString(sum[:3]) + "-" + newULID(t)
+}
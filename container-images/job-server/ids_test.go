@@ -0,0 +1,55 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dnsLabel is what Kubernetes accepts as a Job, ConfigMap or NetworkPolicy name.
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+func TestNewSubmissionID(t *testing.T) {
+	base := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		assignment string
+		t          time.Time
+	}{
+		{"pa2", base},
+		{"", base},
+		{"Vector Add (OpenCL) — " + strings.Repeat("long title ", 20), base},
+		{"pa2", time.UnixMilli(0)},
+		{"pa2", time.UnixMilli(1<<48 - 1)},
+	}
+	for _, tt := range tests {
+		id := newSubmissionID(tt.assignment, tt.t)
+		// Preempted attempts add "-r<n>" to the ID.
+		if name := (&queuedJob{id: id, attempt: 99}).k8sName(); len(name) > 63 || !dnsLabel.MatchString(name) {
+			t.Errorf("newSubmissionID(%q) = %q is not a valid Kubernetes name", tt.assignment, name)
+		}
+		if sanitizeK8sName(id) != id {
+			t.Errorf("newSubmissionID(%q) = %q changes when sanitized", tt.assignment, id)
+		}
+	}
+
+	var ids []string
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := newSubmissionID("pa2", base.Add(time.Duration(i/10)*time.Millisecond))
+		if seen[id] {
+			t.Fatalf("duplicate ID %s", id)
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	// IDs of different milliseconds sort by time; within one millisecond the
+	// order is random, so compare the timestamp part only.
+	if !sort.SliceIsSorted(ids, func(i, j int) bool { return ids[i][:17] < ids[j][:17] }) {
+		t.Error("IDs do not sort by submission time")
+	}
+	if a, b := newSubmissionID("pa1", base), newSubmissionID("pa2", base); a[:6] == b[:6] {
+		t.Errorf("assignments share the prefix %s", a[:6])
+	}
+}
@@ -0,0 +1,809 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"greengrader/webserver/gradescope"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// jobNamespace is where jobs of tenants without their own namespace run.
+const jobNamespace = "default"
+
+// Job statuses reported by /status/.
+const (
+	statusQueued    = "queued"
+	statusPending   = "pending"
+	statusSucceeded = "succeeded"
+	statusFailed    = "failed"
+	// statusCached is a submission answered from the result cache without a run.
+	statusCached = "cached"
+	// statusSuperseded is a queued job dropped for a newer submission by a member of its group.
+	statusSuperseded = "superseded"
+)
+
+// JobResponse is sent back to the client immediately after job creation.
+type JobResponse struct {
+	Status string `json:"status"`
+	JobID  string `json:"job_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// JobStatusPayload is sent back to the client when polling for status.
+type JobStatusPayload struct {
+	Status  string `json:"status"`            // "queued", "pending", "succeeded", "failed", "cached", "superseded"
+	Results string `json:"results,omitempty"` // Gradescope results.json
+	Error   string `json:"error,omitempty"`   // Error message if job failed or logs couldn't be fetched
+	Latency string `json:"latency,omitempty"` // e.g. "1m30s"
+
+	FailureReason string `json:"failure_reason,omitempty"` // "oom_killed", "evicted"
+
+	Node      string             `json:"node,omitempty"`
+	Placement *PlacementDecision `json:"placement,omitempty"`
+
+	QueuePosition *int `json:"queue_position,omitempty"` // jobs ahead of this one while queued
+}
+
+// JobRecord is everything the server knows about one submission.
+type JobRecord struct {
+	ID      string `json:"id"`
+	Student string `json:"student"` // roster ID, or the sanitized name of an unlisted submitter
+	// Students lists every member of a group submission, Student first.
+	Students   []string      `json:"students,omitempty"`
+	Assignment string        `json:"assignment"`
+	Priority   string        `json:"priority"`
+	Tenant     string        `json:"tenant"`
+	Namespace  string        `json:"namespace"`
+	Status     string        `json:"status"`
+	Submitted  time.Time     `json:"submitted"`
+	Finished   time.Time     `json:"finished,omitempty"`
+	Latency    time.Duration `json:"latency,omitempty"`
+	Results    []byte        `json:"results,omitempty"` // Gradescope results.json
+	Error      string        `json:"error,omitempty"`
+	// Archive is the SHA-256 of the submitted archive, stored in archiveDir.
+	Archive string `json:"archive,omitempty"`
+	// ImageDigest is the runner image the results came from; CachedFrom is
+	// the job whose results a cached submission reused.
+	ImageDigest string `json:"image_digest,omitempty"`
+	CachedFrom  string `json:"cached_from,omitempty"`
+	// RegradeOf is the submission a bulk regrade run re-grades.
+	RegradeOf string `json:"regrade_of,omitempty"`
+	// Metadata is Gradescope's submission_metadata.json, when the client sent it.
+	Metadata *gradescope.SubmissionMetadata `json:"metadata,omitempty"`
+	// Warnings are the findings of warning-level pre-checks, added to the results.
+	Warnings []precheckFinding `json:"warnings,omitempty"`
+	// RosterFlag is set when an unlisted submitter was let through by a "flag" roster policy.
+	RosterFlag string `json:"roster_flag,omitempty"`
+	// Output is the runner's raw output (up to maxStoredOutput), served to staff by /jobs/{id}/logs.
+	Output []byte `json:"-"`
+	// FailureReason is set when Kubernetes ended the run, e.g. "oom_killed" or "evicted".
+	FailureReason string `json:"failure_reason,omitempty"`
+
+	// Placement is where the server asked the job to run and why; Node is where it actually ran.
+	Placement *PlacementDecision `json:"placement,omitempty"`
+	Node      string             `json:"node,omitempty"`
+
+	// Preemptions counts how often the run was stopped and requeued for higher-priority work.
+	Preemptions int `json:"preemptions,omitempty"`
+
+	// Test bundle version the job was graded against.
+	TestBundle        string `json:"test_bundle,omitempty"`
+	TestBundleVersion int    `json:"test_bundle_version,omitempty"`
+
+	// Dataset generation inputs, kept so the exact dataset can be rebuilt.
+	DatasetGenerator string `json:"dataset_generator,omitempty"`
+	DatasetSeed      *int64 `json:"dataset_seed,omitempty"`
+}
+
+// jobStore is an in-memory map of all jobs by ID, backed by one file per
+// job in jobsDir.
+var (
+	jobStore      = make(map[string]*JobRecord)
+	jobStoreMutex sync.Mutex
+)
+
+// jobsDir keeps the job records, so submissions, their scores and the
+// dataset seeds they were graded with survive restarts. The runner output
+// is not kept. It is a variable so tests can point it elsewhere.
+var jobsDir = "/app/jobs"
+
+func init() {
+	loadJobs()
+}
+
+// loadJobs reads the records in jobsDir into the job store. Jobs that were
+// still queued or running are marked failed, since their runs are lost.
+func loadJobs() {
+	entries, err := os.ReadDir(jobsDir)
+	if err != nil {
+		return
+	}
+	interrupted := 0
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(jobsDir, e.Name()))
+		if err != nil {
+			log.Printf("Ignoring unreadable job record %s: %v", e.Name(), err)
+			continue
+		}
+		var rec JobRecord
+		if err := json.Unmarshal(data, &rec); err != nil || rec.ID == "" {
+			log.Printf("Ignoring unreadable job record %s: %v", e.Name(), err)
+			continue
+		}
+		if rec.Status == statusQueued || rec.Status == statusPending {
+			// Its queue entry and run went away with the previous server.
+			rec.Status = statusFailed
+			rec.Error = "Interrupted by a server restart"
+			rec.Results = errorResults("The grading server restarted before this submission was graded. Please submit again.", nil)
+			rec.Finished = time.Now()
+			if err := saveJob(&rec); err != nil {
+				log.Printf("Saving job %s: %v", rec.ID, err)
+			}
+			interrupted++
+		}
+		jobStore[rec.ID] = &rec
+	}
+	if interrupted > 0 {
+		log.Printf("%d jobs were interrupted by the restart", interrupted)
+	}
+}
+
+// saveJob writes the record to jobsDir; jobStoreMutex must be held.
+func saveJob(rec *JobRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(jobsDir, 0o700); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(jobsDir, "job_tmp_*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	file.Close()
+	if err := os.Rename(file.Name(), filepath.Join(jobsDir, rec.ID+".json")); err != nil { // atomic replace
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+func putJob(rec *JobRecord) {
+	jobStoreMutex.Lock()
+	jobStore[rec.ID] = rec
+	if err := saveJob(rec); err != nil {
+		log.Printf("Saving job %s: %v", rec.ID, err)
+	}
+	jobStoreMutex.Unlock()
+}
+
+// getJob returns a copy of the record so callers can read it without holding the lock.
+func getJob(id string) (JobRecord, bool) {
+	jobStoreMutex.Lock()
+	defer jobStoreMutex.Unlock()
+	rec, ok := jobStore[id]
+	if !ok {
+		return JobRecord{}, false
+	}
+	return *rec, true
+}
+
+// members returns the students the submission is credited to.
+func (rec *JobRecord) members() []string {
+	if len(rec.Students) == 0 {
+		return []string{rec.Student}
+	}
+	return rec.Students
+}
+
+// sharesMember reports whether any of students is a member of the submission.
+func (rec *JobRecord) sharesMember(students []string) bool {
+	for _, s := range rec.members() {
+		if slices.Contains(students, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// supersede drops the queued, not yet started submissions to the same
+// assignment by any member of rec's group; the newest submission wins.
+func supersede(rec *JobRecord) {
+	var ids []string
+	jobStoreMutex.Lock()
+	for _, old := range jobStore {
+		if old.ID != rec.ID && old.Status == statusQueued && old.Priority == priorityStudent &&
+			old.Assignment == rec.Assignment && old.sharesMember(rec.members()) {
+			ids = append(ids, old.ID)
+		}
+	}
+	jobStoreMutex.Unlock()
+	for _, id := range ids {
+		if !queue.remove(id) {
+			continue // already dispatched
+		}
+		updateJob(id, func(old *JobRecord) {
+			old.Status = statusSuperseded
+			old.Error = "Superseded by " + rec.ID
+			old.Results = supersededResults(rec.ID)
+			old.Finished = time.Now()
+		})
+		log.Printf("Job %s superseded by %s", id, rec.ID)
+	}
+}
+
+// supersededResults is the results.json of a superseded submission; it
+// points the student at the newer job, which is the one that gets graded.
+func supersededResults(newer string) []byte {
+	zero := 0.0
+	data, _ := json.Marshal(gradescope.Results{
+		Score:  &zero,
+		Output: "This submission was not graded because a newer submission from your group (job " + newer + ") replaced it while it was queued. The newer submission's score counts.",
+	})
+	return data
+}
+
+func updateJob(id string, fn func(*JobRecord)) {
+	jobStoreMutex.Lock()
+	defer jobStoreMutex.Unlock()
+	if rec, ok := jobStore[id]; ok {
+		fn(rec)
+		if err := saveJob(rec); err != nil {
+			log.Printf("Saving job %s: %v", id, err)
+		}
+	}
+}
+
+var invalidNameChars = regexp.MustCompile("[^a-z0-9.-]+")
+
+// sanitizeK8sName converts a string to be RFC 1123 compliant (lowercase alphanumeric, '-', '.', and starts/ends with alphanumeric).
+func sanitizeK8sName(s string) string {
+	s = strings.ToLower(s)
+	s = invalidNameChars.ReplaceAllString(s, "-")
+	s = strings.Trim(s, "-.")
+	s = strings.ReplaceAll(s, "--", "-")
+	return s
+}
+
+// startJob creates the Kubernetes objects for a queued submission and monitors them in the background.
+func startJob(clientset kubernetes.Interface, j *queuedJob) error {
+	rec, ok := getJob(j.id)
+	if !ok {
+		return fmt.Errorf("no job record")
+	}
+	a := j.assignment
+	name := j.k8sName()
+	j.namespace = lookupTenant(j.tenant).namespace()
+
+	// placement comes first: a job no phone can take goes back to the queue
+	decision, err := planPlacement(clientset, a)
+	if errors.Is(err, errNoPhone) {
+		updateJob(j.id, func(r *JobRecord) { r.Placement = decision })
+		return err
+	}
+	if err != nil {
+		log.Printf("Job %s: %v, leaving placement to the scheduler", name, err)
+	}
+
+	zipData, err := loadArchive(j.archive)
+	if err != nil {
+		return fmt.Errorf("failed to load the submission: %v", err)
+	}
+	configMapName := "script-cm-" + name
+	cmClient := clientset.CoreV1().ConfigMaps(j.namespace)
+	scriptData := map[string][]byte{
+		"archive.zip": zipData,
+	}
+	if rec.Metadata != nil {
+		metadata, err := runnerMetadata(rec.Tenant, rec.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to prepare submission metadata: %v", err)
+		}
+		scriptData["submission_metadata.json"] = metadata
+	}
+	_, err = cmClient.Create(context.TODO(), &corev1.ConfigMap{
+		ObjectMeta: meta.ObjectMeta{
+			Name: configMapName,
+		},
+		BinaryData: scriptData,
+	}, meta.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create ConfigMap: %v", err)
+	}
+	cleanupNames := []string{configMapName}
+	policyClient := clientset.NetworkingV1().NetworkPolicies(j.namespace)
+	secretClient := clientset.CoreV1().Secrets(j.namespace)
+	var policyName, secretName string
+	cleanup := func() {
+		for _, cm := range cleanupNames {
+			if err := cmClient.Delete(context.Background(), cm, meta.DeleteOptions{}); err != nil {
+				log.Printf("Error deleting ConfigMap %s: %v", cm, err)
+			}
+		}
+		if secretName != "" {
+			if err := secretClient.Delete(context.Background(), secretName, meta.DeleteOptions{}); err != nil {
+				log.Printf("Error deleting Secret %s: %v", secretName, err)
+			}
+		}
+		if policyName != "" {
+			if err := policyClient.Delete(context.Background(), policyName, meta.DeleteOptions{}); err != nil {
+				log.Printf("Error deleting NetworkPolicy %s: %v", policyName, err)
+			}
+		}
+	}
+
+	// the policy has to exist before the pod starts
+	policy, err := policyClient.Create(context.TODO(), denyEgressPolicy(name), meta.CreateOptions{})
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("failed to create NetworkPolicy: %v", err)
+	}
+	policyName = policy.Name
+
+	job, err := buildJob(name, configMapName, a)
+	if err != nil {
+		cleanup()
+		return err
+	}
+	applyPriority(&job.Spec.Template.Spec, j.priority)
+	if rec.Metadata != nil {
+		runner := &job.Spec.Template.Spec.Containers[0]
+		runner.Env = append(runner.Env, corev1.EnvVar{Name: "SUBMISSION_METADATA", Value: "/scripts/submission_metadata.json"})
+	}
+	applyPodFailurePolicy(job, j.priority)
+
+	if a.Dataset != nil {
+		seed := datasetSeed(rec.Student, rec.Assignment)
+		updateJob(j.id, func(r *JobRecord) {
+			r.DatasetGenerator = a.Dataset.Generator
+			r.DatasetSeed = &seed
+		})
+
+		files, err := generateDataset(a.Dataset, seed)
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to generate dataset: %v", err)
+		}
+		data, items := datasetVolumeItems(files)
+		datasetCM := "dataset-cm-" + name
+		_, err = cmClient.Create(context.TODO(), &corev1.ConfigMap{
+			ObjectMeta: meta.ObjectMeta{Name: datasetCM},
+			BinaryData: data,
+		}, meta.CreateOptions{})
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to create dataset ConfigMap: %v", err)
+		}
+		cleanupNames = append(cleanupNames, datasetCM)
+		mountDataset(&job.Spec.Template.Spec, datasetCM, items, a.Dataset.MountPath)
+	}
+
+	if a.TestBundle != nil {
+		files, version, err := loadBundle(clientset, a.TestBundle, a.tenant())
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to load test bundle: %v", err)
+		}
+		data, items := datasetVolumeItems(files)
+		_, err = secretClient.Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: meta.ObjectMeta{Name: "tests-" + name},
+			Data:       data,
+		}, meta.CreateOptions{})
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("failed to create test bundle Secret: %v", err)
+		}
+		secretName = "tests-" + name
+		mountBundle(&job.Spec.Template.Spec, secretName, items, a.TestBundle.MountPath)
+		updateJob(j.id, func(r *JobRecord) {
+			r.TestBundle = a.TestBundle.Name
+			r.TestBundleVersion = version
+		})
+	}
+
+	applyPlacement(&job.Spec.Template.Spec, decision)
+
+	_, err = clientset.BatchV1().Jobs(j.namespace).Create(context.TODO(), job, meta.CreateOptions{})
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("failed to create Job: %v", err)
+	}
+	updateJob(j.id, func(r *JobRecord) {
+		r.Status = statusPending
+		r.Namespace = j.namespace
+		r.Placement = decision
+	})
+
+	go func() {
+		defer cleanup()
+		monitorJob(clientset, j, rec.Submitted)
+	}()
+	return nil
+}
+
+// buildJob returns the Job that runs a's grading command against the
+// submission stored in configMapName.
+func buildJob(name, configMapName string, a *Assignment) (*batchv1.Job, error) {
+	resources, err := a.Resources.requirements()
+	if err != nil {
+		return nil, fmt.Errorf("assignment %s: %v", a.Name, err)
+	}
+	addOpenCLRequest(&resources, a.OpenCL)
+	profile, err := lookupSecurityProfile(a.Security)
+	if err != nil {
+		return nil, fmt.Errorf("assignment %s: %v", a.Name, err)
+	}
+	job_ttl := int32(120)    //How long to keep job alive after completion (120 seconds)
+	backoffLimit := int32(0) // a crashed or OOM-killed run is reported, not retried
+	job := &batchv1.Job{
+		ObjectMeta: meta.ObjectMeta{
+			Name: name,
+		},
+		Spec: batchv1.JobSpec{
+			TTLSecondsAfterFinished: &job_ttl,
+			BackoffLimit:            &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: meta.ObjectMeta{
+					Labels: map[string]string{runnerRoleLabel: "runner"},
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Volumes: []corev1.Volume{
+						{
+							Name: "script-volume",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: configMapName,
+									},
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:            "runner",
+							Image:           a.Image,
+							ImagePullPolicy: corev1.PullAlways,
+							Command:         a.Command,
+							Resources:       resources,
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "script-volume",
+									MountPath: "/scripts",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	applySecurityProfile(&job.Spec.Template.Spec, profile)
+	if a.Benchmark != nil {
+		wrapBenchmark(&job.Spec.Template.Spec.Containers[0], a.Benchmark)
+		makeExclusive(&job.Spec.Template, a.Benchmark)
+	}
+	return job, nil
+}
+
+// mountDataset adds the generated dataset ConfigMap to the runner container.
+func mountDataset(spec *corev1.PodSpec, configMapName string, items []corev1.KeyToPath, mountPath string) {
+	if mountPath == "" {
+		mountPath = "/dataset"
+	}
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: "dataset-volume",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: configMapName},
+				Items:                items,
+			},
+		},
+	})
+	runner := &spec.Containers[0]
+	runner.VolumeMounts = append(runner.VolumeMounts, corev1.VolumeMount{
+		Name:      "dataset-volume",
+		MountPath: mountPath,
+		ReadOnly:  true,
+	})
+	runner.Env = append(runner.Env, corev1.EnvVar{Name: "DATASET_DIR", Value: mountPath})
+}
+
+// monitorJob polls the Job until it finishes, then stores its results in the
+// job record. A run that was preempted and requeued records nothing.
+func monitorJob(clientset kubernetes.Interface, j *queuedJob, submissionTime time.Time) {
+	a := j.assignment
+	jobName := j.k8sName()
+	log.Printf("Starting goroutine to monitor job %s", jobName)
+	jobClient := clientset.BatchV1().Jobs(j.namespace)
+	defer func() {
+		propagation := meta.DeletePropagationBackground
+		if err := jobClient.Delete(context.Background(), jobName, meta.DeleteOptions{PropagationPolicy: &propagation}); err != nil {
+			log.Printf("Error deleting Job %s: %v", jobName, err)
+		}
+	}()
+
+	var finalStatus string
+	var jobError error
+
+	// Poll for Job completion
+	for {
+		job, err := jobClient.Get(context.TODO(), jobName, meta.GetOptions{})
+		if queue.wasPreempted(j) {
+			return
+		}
+		if err != nil {
+			jobError = fmt.Errorf("failed to get job status for %s: %v", jobName, err)
+			finalStatus = statusFailed
+			break
+		}
+		if job.Status.Succeeded > 0 {
+			finalStatus = statusSucceeded
+			break
+		} else if job.Status.Failed > 0 {
+			finalStatus = statusFailed
+			jobError = fmt.Errorf("job %s failed on Kubernetes", jobName)
+			break
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	pod, logs, err := fetchJobPod(clientset, j.namespace, jobName)
+	if err != nil && jobError == nil {
+		jobError = err
+	}
+	var failureReason, node string
+	if pod != nil {
+		failureReason = podFailureReason(pod)
+		node = pod.Spec.NodeName
+	}
+
+	var benchmarkTimes []float64
+	if a.Benchmark != nil {
+		logs, benchmarkTimes = splitBenchmarkOutput(logs)
+	}
+
+	var results []byte
+	if failureReason != "" {
+		finalStatus = statusFailed
+		results = errorResults(failureMessage(failureReason, a), logs)
+	} else {
+		results, err = convertResults(a, logs)
+		if err == nil && finalStatus == statusSucceeded {
+			if rec, ok := getJob(j.id); ok {
+				storeCachedResult(a, rec, results)
+			}
+		}
+		if err == nil && a.Benchmark != nil {
+			results, err = applyBenchmark(a.Benchmark, results, benchmarkTimes, nodeHardwareClass(clientset, node, a.Benchmark))
+		}
+		if err == nil {
+			rec, _ := getJob(j.id)
+			scoredAt := submissionTime
+			if orig, ok := getJob(rec.RegradeOf); ok {
+				scoredAt = orig.Submitted // a regrade is scored as of the original submission
+			}
+			results, err = applyScoring(a.Scoring, results, scoredAt, rec.Metadata)
+		}
+		if err != nil {
+			results = errorResults(fmt.Sprintf("Could not read the grader's results: %v", err), logs)
+		}
+	}
+	if rec, ok := getJob(j.id); ok {
+		results = attachWarnings(results, rec.Warnings)
+	}
+
+	completion := time.Now()
+	// Releasing the slot and checking the run is still current are one step,
+	// so a run preempted as it finished cannot overwrite its requeued attempt.
+	if !queue.finish(j) {
+		log.Printf("Job %s finished after it was preempted; dropping its results", jobName)
+		return
+	}
+	updateJob(j.id, func(r *JobRecord) {
+		r.Status = finalStatus
+		r.Results = results
+		r.Finished = completion
+		r.Latency = completion.Sub(submissionTime)
+		r.FailureReason = failureReason
+		r.Node = node
+		if pod != nil {
+			r.ImageDigest = podImageDigest(pod)
+		}
+		r.Output = logs
+		if len(logs) > maxStoredOutput {
+			r.Output = append(logs[:maxStoredOutput:maxStoredOutput], "\n[output truncated]\n"...)
+		}
+		if jobError != nil {
+			r.Error = jobError.Error()
+		}
+	})
+	log.Printf("Job %s completed with status: %s, Latency: %s", jobName, finalStatus, completion.Sub(submissionTime))
+	updateLatency(submissionTime, completion)
+}
+
+// fetchJobPod returns the (single) pod the Job created and its logs.
+func fetchJobPod(clientset kubernetes.Interface, namespace, jobName string) (*corev1.Pod, []byte, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), meta.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", jobName),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list pods for job %s: %v", jobName, err)
+	}
+	if len(pods.Items) == 0 {
+		return nil, nil, fmt.Errorf("no pods found for job %s", jobName)
+	}
+	pod := &pods.Items[0]
+	logStream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).Stream(context.TODO())
+	if err != nil {
+		return pod, nil, fmt.Errorf("failed to stream pod logs for %s (pod %s): %v", jobName, pod.Name, err)
+	}
+	defer logStream.Close()
+	logs, err := io.ReadAll(logStream)
+	if err != nil {
+		return pod, nil, fmt.Errorf("failed to read pod logs for %s (pod %s): %v", jobName, pod.Name, err)
+	}
+	return pod, logs, nil
+}
+
+// statusHandler serves /status/{jobID}.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jobName := strings.TrimPrefix(r.URL.Path, "/status/")
+	if jobName == "" {
+		http.Error(w, "Missing job ID in URL path, e.g., /status/<job_id>", http.StatusBadRequest)
+		return
+	}
+	rec, found := getJob(jobName)
+	if !found {
+		http.Error(w, "Job ID not found", http.StatusNotFound)
+		return
+	}
+	if !allowed(w, r, permPoll, rec.Tenant) {
+		return
+	}
+
+	payload := JobStatusPayload{Status: rec.Status, Placement: rec.Placement}
+	if rec.Status == statusQueued {
+		if pos := queue.position(rec.ID); pos >= 0 {
+			payload.QueuePosition = &pos
+		}
+	}
+	if rec.Status == statusSuperseded {
+		payload.Results = string(rec.Results)
+		payload.Error = rec.Error
+	}
+	if rec.Status == statusSucceeded || rec.Status == statusFailed || rec.Status == statusCached {
+		payload.Results = string(rec.Results)
+		payload.Latency = rec.Latency.String()
+		payload.Error = rec.Error
+		payload.FailureReason = rec.FailureReason
+		payload.Node = rec.Node
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payload)
+}
+
+// maxStoredOutput caps the runner output kept per job for /jobs/{id}/logs.
+const maxStoredOutput = 64 << 10
+
+// jobSummary is one entry of the /jobs listing.
+type jobSummary struct {
+	ID            string    `json:"id"`
+	Student       string    `json:"student"`
+	Students      []string  `json:"students,omitempty"`
+	Assignment    string    `json:"assignment"`
+	Course        string    `json:"course"`
+	Priority      string    `json:"priority"`
+	Status        string    `json:"status"`
+	Submitted     time.Time `json:"submitted"`
+	Finished      time.Time `json:"finished,omitempty"`
+	FailureReason string    `json:"failure_reason,omitempty"`
+	Node          string    `json:"node,omitempty"`
+}
+
+// jobsHandler serves GET /jobs (filtered by the course, assignment, student
+// and status query parameters), GET /jobs/{id}, GET /jobs/{id}/logs and
+// GET /jobs/{id}/archive to course staff. Submission IDs are opaque; GET /jobs/{id} is how staff find
+// out whose submission a Kubernetes object belongs to.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := principalFrom(r)
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+	if id, ok := strings.CutSuffix(rest, "/logs"); ok {
+		rec, found := getJob(id)
+		if !found || !p.can(permViewJobs, rec.Tenant) {
+			http.Error(w, "Job ID not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(rec.Output)
+		return
+	}
+	if id, ok := strings.CutSuffix(rest, "/archive"); ok {
+		rec, found := getJob(id)
+		if !found || !p.can(permViewJobs, rec.Tenant) {
+			http.Error(w, "Job ID not found", http.StatusNotFound)
+			return
+		}
+		data, err := loadArchive(rec.Archive)
+		if err != nil {
+			http.Error(w, "Archive not available", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", "attachment; filename="+rec.Archive+".zip")
+		w.Write(data)
+		return
+	}
+	if rest != "" {
+		rec, found := getJob(rest)
+		if strings.Contains(rest, "/") || !found || !p.can(permViewJobs, rec.Tenant) {
+			http.Error(w, "Job ID not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Job %s looked up by %s", rec.ID, p.ID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			JobRecord
+			Results json.RawMessage `json:"results,omitempty"`
+		}{rec, rec.Results})
+		return
+	}
+
+	q := r.URL.Query()
+	list := []jobSummary{}
+	jobStoreMutex.Lock()
+	for _, rec := range jobStore {
+		if !p.can(permViewJobs, rec.Tenant) ||
+			q.Get("course") != "" && rec.Tenant != q.Get("course") ||
+			q.Get("assignment") != "" && rec.Assignment != q.Get("assignment") ||
+			q.Get("student") != "" && !slices.Contains(rec.members(), q.Get("student")) ||
+			q.Get("status") != "" && rec.Status != q.Get("status") {
+			continue
+		}
+		list = append(list, jobSummary{
+			ID: rec.ID, Student: rec.Student, Students: rec.Students, Assignment: rec.Assignment, Course: rec.Tenant,
+			Priority: rec.Priority, Status: rec.Status, Submitted: rec.Submitted, Finished: rec.Finished,
+			FailureReason: rec.FailureReason, Node: rec.Node,
+		})
+	}
+	jobStoreMutex.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Submitted.After(list[j].Submitted) })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
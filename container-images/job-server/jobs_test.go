@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"greengrader/webserver/gradescope"
+)
+
+// withJobs gives the test an empty job store, saved to a temporary
+// directory, and an empty queue.
+func withJobs(t *testing.T) {
+	t.Helper()
+	jobStoreMutex.Lock()
+	savedStore, savedDir := jobStore, jobsDir
+	jobStore, jobsDir = map[string]*JobRecord{}, t.TempDir()
+	jobStoreMutex.Unlock()
+	savedQueue := queue
+	queue = newJobQueue()
+	t.Cleanup(func() {
+		jobStoreMutex.Lock()
+		jobStore, jobsDir = savedStore, savedDir
+		jobStoreMutex.Unlock()
+		queue = savedQueue
+	})
+}
+
+// queueRecord stores a queued record and puts it in the queue.
+func queueRecord(rec *JobRecord) {
+	rec.Status = statusQueued
+	putJob(rec)
+	queue.push(&queuedJob{id: rec.ID, priority: rec.Priority, tenant: rec.Tenant, enqueued: rec.Submitted})
+}
+
+func TestSupersede(t *testing.T) {
+	withJobs(t)
+	now := time.Now()
+	records := []*JobRecord{
+		{ID: "group-old", Student: "a", Students: []string{"a", "b"}, Assignment: "pa1", Priority: priorityStudent},
+		{ID: "other-student", Student: "c", Assignment: "pa1", Priority: priorityStudent},
+		{ID: "other-assignment", Student: "b", Assignment: "pa2", Priority: priorityStudent},
+		{ID: "staff-run", Student: "b", Assignment: "pa1", Priority: priorityStaff},
+	}
+	for i, rec := range records {
+		rec.Submitted = now.Add(time.Duration(i) * time.Second)
+		queueRecord(rec)
+	}
+	newer := &JobRecord{ID: "newer", Student: "b", Assignment: "pa1", Priority: priorityStudent}
+	queueRecord(newer)
+	supersede(newer)
+
+	want := map[string]string{
+		"group-old":        statusSuperseded,
+		"other-student":    statusQueued,
+		"other-assignment": statusQueued,
+		"staff-run":        statusQueued,
+		"newer":            statusQueued,
+	}
+	for id, status := range want {
+		rec, _ := getJob(id)
+		if rec.Status != status {
+			t.Errorf("%s is %s, want %s", id, rec.Status, status)
+		}
+		if inQueue := queue.position(id) >= 0; inQueue != (status == statusQueued) {
+			t.Errorf("%s in queue = %v with status %s", id, inQueue, rec.Status)
+		}
+	}
+
+	// The superseded job is final for clients polling it, with a results.json
+	// that points at the newer job.
+	t.Setenv("ADMIN_TOKEN", "test-admin")
+	r := httptest.NewRequest(http.MethodGet, "/status/group-old", nil)
+	r.Header.Set("Authorization", "Bearer test-admin")
+	w := httptest.NewRecorder()
+	authenticated(statusHandler)(w, r)
+	var payload JobStatusPayload
+	if err := json.NewDecoder(w.Body).Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	var res gradescope.Results
+	if err := json.Unmarshal([]byte(payload.Results), &res); err != nil {
+		t.Fatalf("superseded results %q: %v", payload.Results, err)
+	}
+	if payload.Status != statusSuperseded || res.Score == nil || *res.Score != 0 || !strings.Contains(res.Output, "job newer") {
+		t.Errorf("status %s with results %s, want a zero score pointing at job newer", payload.Status, payload.Results)
+	}
+}
+
+func TestJobRecordsSurviveRestart(t *testing.T) {
+	withJobs(t)
+	seed := int64(42)
+	submitted := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	putJob(&JobRecord{ID: "done", Student: "a", Students: []string{"a", "b"}, Assignment: "pa2", Submitted: submitted, Status: statusPending, Archive: "abc"})
+	updateJob("done", func(r *JobRecord) {
+		r.Status = statusSucceeded
+		r.Results = []byte(`{"score": 9}`)
+		r.DatasetSeed = &seed
+		r.Output = []byte("runner output")
+	})
+	putJob(&JobRecord{ID: "waiting", Student: "c", Assignment: "pa2", Submitted: submitted, Status: statusQueued})
+
+	// A new server process starts with an empty store.
+	jobStoreMutex.Lock()
+	jobStore = map[string]*JobRecord{}
+	jobStoreMutex.Unlock()
+	loadJobs()
+
+	done, ok := getJob("done")
+	if !ok || done.Status != statusSucceeded || string(done.Results) != `{"score": 9}` || done.Archive != "abc" ||
+		!done.Submitted.Equal(submitted) || done.DatasetSeed == nil || *done.DatasetSeed != 42 || len(done.Students) != 2 {
+		t.Errorf("reloaded %+v", done)
+	}
+	if done.Output != nil {
+		t.Errorf("runner output was persisted: %q", done.Output)
+	}
+	waiting, _ := getJob("waiting")
+	if waiting.Status != statusFailed || resultScore(waiting.Results) == nil || *resultScore(waiting.Results) != 0 {
+		t.Errorf("a job queued before the restart is %s with results %s, want failed with a zero score", waiting.Status, waiting.Results)
+	}
+
+	// The interrupted job stays failed across the next restart too.
+	jobStoreMutex.Lock()
+	jobStore = map[string]*JobRecord{}
+	jobStoreMutex.Unlock()
+	loadJobs()
+	if again, _ := getJob("waiting"); again.Status != statusFailed || !again.Finished.Equal(waiting.Finished) {
+		t.Errorf("after a second restart: %+v", again)
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"encoding/json"
 	"log"
+	"net/http"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -14,9 +16,27 @@ type latencyState struct {
 	MaxEnd        time.Time `json:"max_end"`
 	TotalSeconds  float64   `json:"total_seconds"`
 	Jobs          int       `json:"jobs"`
+
+	Tenants map[string]*tenantUsage `json:"tenants,omitempty"`
 }
 
-var state latencyState
+var (
+	state      latencyState
+	stateMutex sync.Mutex
+)
+
+// usage returns the tenant's usage counters, creating them on first use.
+func (s *latencyState) usage(tenant string) *tenantUsage {
+	if s.Tenants == nil {
+		s.Tenants = map[string]*tenantUsage{}
+	}
+	u, ok := s.Tenants[tenant]
+	if !ok {
+		u = &tenantUsage{}
+		s.Tenants[tenant] = u
+	}
+	return u
+}
 
 func init() {
 	// Try to load previous state (survives pod restarts if /app is persisted)
@@ -28,6 +48,8 @@ func init() {
 
 func updateLatency(start, end time.Time) {
 	delta := end.Sub(start).Seconds()
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
 
 	// first job ever
 	if state.Jobs == 0 || start.Before(state.MinStart) {
@@ -42,6 +64,7 @@ func updateLatency(start, end time.Time) {
 	save()
 }
 
+// save writes the state to stateFile; stateMutex must be held.
 func save() {
 	file, err := os.CreateTemp("/app", "lat_tmp_*")
 	if err != nil {
@@ -55,3 +78,26 @@ func save() {
 	file.Close()
 	_ = os.Rename(file.Name(), stateFile) // atomic replace
 }
+
+// metricsHandler reports the latency totals and each tenant's share of the cluster.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET method allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !allowed(w, r, permAdmin, "") {
+		return
+	}
+	stateMutex.Lock()
+	latency := state
+	latency.Tenants = nil
+	stateMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		latencyState
+		Running int                      `json:"running"`
+		Slots   int                      `json:"slots"`
+		Tenants map[string]tenantMetrics `json:"tenants"`
+	}{latency, queue.runningCount(), maxRunningJobs(), currentTenantMetrics()})
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Objects the server manages in every course namespace.
+const (
+	tenantLabel         = "greengrader.ucsd.edu/tenant"
+	managedQuotaName    = "greengrader-quota"
+	managedLimitsName   = "greengrader-limits"
+	managedBindingName  = "job-server"
+	runnerClusterRole   = "job-server-runner" // defined in jobserver.yaml
+	serverAccountName   = "job-server-sa"
+	defaultServerNSName = "default"
+)
+
+// namespace is where the tenant's jobs run.
+func (t *Tenant) namespace() string {
+	if t.Namespace != "" {
+		return t.Namespace
+	}
+	return jobNamespace
+}
+
+// serverNamespace is the namespace of the server's ServiceAccount (POD_NAMESPACE).
+func serverNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	return defaultServerNSName
+}
+
+// resourceList parses a map of resource names to quantities.
+func resourceList(m map[string]string) (corev1.ResourceList, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	list := corev1.ResourceList{}
+	for name, value := range m {
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity %q for %s: %v", value, name, err)
+		}
+		list[corev1.ResourceName(name)] = q
+	}
+	return list, nil
+}
+
+// provisionNamespaces creates or updates the namespace, ResourceQuota,
+// LimitRange and RoleBinding of every tenant with its own namespace. It
+// returns the outcome per namespace ("ok" or the error).
+func provisionNamespaces(clientset kubernetes.Interface) map[string]string {
+	report := map[string]string{}
+	for _, t := range tenantSnapshot() {
+		if t.Namespace == "" || t.Archived {
+			continue
+		}
+		if err := provisionNamespace(clientset, t); err != nil {
+			log.Printf("Provisioning namespace %s for %s: %v", t.Namespace, t.Name, err)
+			report[t.Namespace] = err.Error()
+			continue
+		}
+		report[t.Namespace] = "ok"
+	}
+	return report
+}
+
+func provisionNamespace(clientset kubernetes.Interface, t *Tenant) error {
+	ctx := context.TODO()
+	ns := t.namespace()
+	labels := map[string]string{tenantLabel: t.Name}
+
+	existing, err := clientset.CoreV1().Namespaces().Get(ctx, ns, meta.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		_, err = clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{
+			ObjectMeta: meta.ObjectMeta{Name: ns, Labels: labels},
+		}, meta.CreateOptions{})
+	case err == nil && existing.Labels[tenantLabel] != t.Name:
+		if existing.Labels == nil {
+			existing.Labels = map[string]string{}
+		}
+		existing.Labels[tenantLabel] = t.Name
+		_, err = clientset.CoreV1().Namespaces().Update(ctx, existing, meta.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("namespace: %v", err)
+	}
+
+	if err := applyQuota(clientset, t, labels); err != nil {
+		return fmt.Errorf("resource quota: %v", err)
+	}
+	if err := applyLimitRange(clientset, t, labels); err != nil {
+		return fmt.Errorf("limit range: %v", err)
+	}
+	if err := applyRunnerBinding(clientset, ns, labels); err != nil {
+		return fmt.Errorf("role binding: %v", err)
+	}
+	return nil
+}
+
+// applyQuota caps the namespace's total requests, limits and object counts
+// with t.Quota, or removes the managed quota when none is configured.
+func applyQuota(clientset kubernetes.Interface, t *Tenant, labels map[string]string) error {
+	client := clientset.CoreV1().ResourceQuotas(t.namespace())
+	hard, err := resourceList(t.Quota)
+	if err != nil {
+		return err
+	}
+	existing, err := client.Get(context.TODO(), managedQuotaName, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		if hard == nil {
+			return nil
+		}
+		_, err = client.Create(context.TODO(), &corev1.ResourceQuota{
+			ObjectMeta: meta.ObjectMeta{Name: managedQuotaName, Labels: labels},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+		}, meta.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if hard == nil {
+		return client.Delete(context.TODO(), managedQuotaName, meta.DeleteOptions{})
+	}
+	existing.Spec.Hard = hard
+	_, err = client.Update(context.TODO(), existing, meta.UpdateOptions{})
+	return err
+}
+
+// applyLimitRange gives containers that do not set their own resources the
+// tenant's default requests and limits.
+func applyLimitRange(clientset kubernetes.Interface, t *Tenant, labels map[string]string) error {
+	client := clientset.CoreV1().LimitRanges(t.namespace())
+	var limits []corev1.LimitRangeItem
+	if t.DefaultResources != nil {
+		req, err := t.DefaultResources.requirements()
+		if err != nil {
+			return err
+		}
+		limits = []corev1.LimitRangeItem{{
+			Type:           corev1.LimitTypeContainer,
+			Default:        req.Limits,
+			DefaultRequest: req.Requests,
+		}}
+	}
+	existing, err := client.Get(context.TODO(), managedLimitsName, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		if limits == nil {
+			return nil
+		}
+		_, err = client.Create(context.TODO(), &corev1.LimitRange{
+			ObjectMeta: meta.ObjectMeta{Name: managedLimitsName, Labels: labels},
+			Spec:       corev1.LimitRangeSpec{Limits: limits},
+		}, meta.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if limits == nil {
+		return client.Delete(context.TODO(), managedLimitsName, meta.DeleteOptions{})
+	}
+	existing.Spec.Limits = limits
+	_, err = client.Update(context.TODO(), existing, meta.UpdateOptions{})
+	return err
+}
+
+// applyRunnerBinding lets the server's ServiceAccount create and watch grading
+// jobs in the namespace by binding the job-server-runner ClusterRole there.
+func applyRunnerBinding(clientset kubernetes.Interface, ns string, labels map[string]string) error {
+	client := clientset.RbacV1().RoleBindings(ns)
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: meta.ObjectMeta{Name: managedBindingName, Labels: labels},
+		Subjects: []rbacv1.Subject{{
+			Kind:      rbacv1.ServiceAccountKind,
+			Name:      serverAccountName,
+			Namespace: serverNamespace(),
+		}},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     runnerClusterRole,
+		},
+	}
+	existing, err := client.Get(context.TODO(), managedBindingName, meta.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.Create(context.TODO(), binding, meta.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if existing.RoleRef != binding.RoleRef {
+		// the role reference is immutable
+		if err := client.Delete(context.TODO(), managedBindingName, meta.DeleteOptions{}); err != nil {
+			return err
+		}
+		_, err = client.Create(context.TODO(), binding, meta.CreateOptions{})
+		return err
+	}
+	existing.Subjects = binding.Subjects
+	existing.Labels = labels
+	_, err = client.Update(context.TODO(), existing, meta.UpdateOptions{})
+	return err
+}
+
+// namespacesHandler serves POST /admin/namespaces, re-provisioning every
+// course namespace from the tenant configuration.
+func namespacesHandler(clientset kubernetes.Interface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST method allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !allowed(w, r, permAdmin, "") {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(provisionNamespaces(clientset))
+	}
+}
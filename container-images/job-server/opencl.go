@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// openCLResource is the extended resource OpenCL assignments request. Each
+// phone advertises openCLSlotsPerNode() of them, so the scheduler never puts
+// more GPU jobs on a phone than that while CPU-only jobs fill the rest.
+const openCLResource corev1.ResourceName = "greengrader.ucsd.edu/opencl"
+
+// openCLNodeLabel marks whether a node has a usable OpenCL ICD. Nodes
+// labelled "false" get no OpenCL capacity; unlabelled nodes are assumed capable.
+const openCLNodeLabel = "greengrader.ucsd.edu/opencl"
+
+// openCLSlotsPerNode is how many OpenCL jobs may share one phone's GPU (OPENCL_SLOTS_PER_NODE, default 1).
+func openCLSlotsPerNode() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("OPENCL_SLOTS_PER_NODE"), 10, 64); err == nil && n >= 0 {
+		return n
+	}
+	return 1
+}
+
+// addOpenCLRequest makes the runner request slots units of the OpenCL resource.
+func addOpenCLRequest(req *corev1.ResourceRequirements, slots int) {
+	if slots <= 0 {
+		return
+	}
+	q := *resource.NewQuantity(int64(slots), resource.DecimalSI)
+	req.Requests[openCLResource] = q
+	req.Limits[openCLResource] = q
+}
+
+// advertiseOpenCL keeps every node's OpenCL capacity in line with its label.
+// It runs once immediately and then every interval.
+func advertiseOpenCL(clientset kubernetes.Interface, interval time.Duration) {
+	for {
+		if err := syncOpenCLCapacity(clientset, openCLSlotsPerNode()); err != nil {
+			log.Printf("OpenCL capacity sync failed: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func syncOpenCLCapacity(clientset kubernetes.Interface, slots int64) error {
+	nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), meta.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes.Items {
+		want := slots
+		if node.Labels[openCLNodeLabel] == "false" {
+			want = 0
+		}
+		have, exists := node.Status.Capacity[openCLResource]
+		if exists && have.Value() == want || !exists && want == 0 {
+			continue
+		}
+
+		var value any = strconv.FormatInt(want, 10)
+		if want == 0 {
+			value = nil // null removes the key from the capacity map
+		}
+		patch, _ := json.Marshal(map[string]any{
+			"status": map[string]any{"capacity": map[string]any{string(openCLResource): value}},
+		})
+		_, err := clientset.CoreV1().Nodes().Patch(context.TODO(), node.Name, types.MergePatchType, patch, meta.PatchOptions{}, "status")
+		if err != nil {
+			log.Printf("Failed to set OpenCL capacity on node %s: %v", node.Name, err)
+			continue
+		}
+		log.Printf("Node %s: OpenCL capacity %d", node.Name, want)
+	}
+	return nil
+}
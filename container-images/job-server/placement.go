@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Node labels and annotations published by the node agent (container-images/node-agent).
+const (
+	labelThrottled        = "greengrader.ucsd.edu/thermal-throttled"
+	labelBatteryLow       = "greengrader.ucsd.edu/battery-low"
+	labelCharging         = "greengrader.ucsd.edu/charging"
+	annotationTemperature = "greengrader.ucsd.edu/temperature-c"
+)
+
+// runnerRoleLabel is set on every runner pod so the server can count its jobs per node.
+const runnerRoleLabel = "greengrader.ucsd.edu/role"
+
+// Placement modes (PLACEMENT_MODE).
+const (
+	placementAffinity = "affinity" // exclude unhealthy phones, prefer the best ones (default)
+	placementNodeName = "nodename" // require the best phone through node affinity
+	placementOff      = "off"
+)
+
+// Nodes whose Ready condition changed this often within flapWindow are avoided.
+const (
+	flapWindow      = 15 * time.Minute
+	flapTransitions = 3
+)
+
+// unknownTemperatureC ranks phones the node agent has not reported on yet.
+const unknownTemperatureC = 45.0
+
+// Exclusion reasons for phones that still work, just not well. When no
+// healthy phone is left, jobs fall back to these, least bad first.
+const (
+	reasonFlapping   = "flapping between Ready and NotReady"
+	reasonThrottled  = "thermally throttled"
+	reasonLowBattery = "low battery"
+)
+
+// errNoPhone means no phone can take the job right now, so it stays queued.
+var errNoPhone = errors.New("no phone can take the job")
+
+// PlacementDecision records where the server asked for a job to run and why.
+type PlacementDecision struct {
+	Mode      string            `json:"mode"`
+	Preferred []string          `json:"preferred,omitempty"` // best first
+	NodeName  string            `json:"node_name,omitempty"` // set in nodename mode
+	Excluded  map[string]string `json:"excluded,omitempty"`  // node -> reason
+	Fallback  bool              `json:"fallback,omitempty"`  // no healthy phone, so degraded ones were used
+	Reason    string            `json:"reason,omitempty"`
+}
+
+// nodeReadyHistory tracks observed Ready transitions to detect flapping phones.
+var (
+	nodeReadyHistory      = map[string]*readyHistory{}
+	nodeReadyHistoryMutex sync.Mutex
+)
+
+type readyHistory struct {
+	ready       bool
+	transitions []time.Time
+}
+
+func placementMode() string {
+	switch m := os.Getenv("PLACEMENT_MODE"); m {
+	case placementNodeName, placementOff:
+		return m
+	}
+	return placementAffinity
+}
+
+func nodeReady(node *corev1.Node) (bool, time.Time) {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue, c.LastTransitionTime.Time
+		}
+	}
+	return false, time.Time{}
+}
+
+// recordReady updates the node's Ready history and reports whether it is flapping.
+func recordReady(node *corev1.Node, now time.Time) bool {
+	ready, changed := nodeReady(node)
+
+	nodeReadyHistoryMutex.Lock()
+	defer nodeReadyHistoryMutex.Unlock()
+	h, ok := nodeReadyHistory[node.Name]
+	if !ok {
+		h = &readyHistory{ready: ready}
+		nodeReadyHistory[node.Name] = h
+		if !changed.IsZero() {
+			h.transitions = append(h.transitions, changed)
+		}
+	}
+	if h.ready != ready {
+		h.ready = ready
+		h.transitions = append(h.transitions, now)
+	}
+	recent := h.transitions[:0]
+	for _, t := range h.transitions {
+		if now.Sub(t) < flapWindow {
+			recent = append(recent, t)
+		}
+	}
+	h.transitions = recent
+	return len(recent) >= flapTransitions
+}
+
+// exclusionReason returns why a node should not get grading jobs, or "".
+func exclusionReason(node *corev1.Node, now time.Time) string {
+	flapping := recordReady(node, now)
+	if ready, _ := nodeReady(node); !ready {
+		return "not ready"
+	}
+	if node.Spec.Unschedulable {
+		return "cordoned"
+	}
+	for _, t := range node.Spec.Taints {
+		if t.Effect == corev1.TaintEffectNoSchedule || t.Effect == corev1.TaintEffectNoExecute {
+			return "tainted " + t.Key
+		}
+	}
+	if flapping {
+		return reasonFlapping
+	}
+	if node.Labels[labelThrottled] == "true" {
+		return reasonThrottled
+	}
+	if node.Labels[labelBatteryLow] == "true" && node.Labels[labelCharging] != "true" {
+		return reasonLowBattery
+	}
+	return ""
+}
+
+// degraded reports whether a phone excluded for reason can still run jobs.
+func degraded(reason string) bool {
+	return reason == reasonFlapping || reason == reasonThrottled || reason == reasonLowBattery
+}
+
+// trackNodeReadiness records every node's Ready condition each interval, so
+// flapping phones are noticed even while no job is being placed.
+func trackNodeReadiness(clientset kubernetes.Interface, interval time.Duration) {
+	for {
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), meta.ListOptions{})
+		if err != nil {
+			log.Printf("Node readiness check failed: %v", err)
+		} else {
+			now := time.Now()
+			for i := range nodes.Items {
+				recordReady(&nodes.Items[i], now)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+func nodeTemperature(node *corev1.Node) float64 {
+	if t, err := strconv.ParseFloat(node.Annotations[annotationTemperature], 64); err == nil {
+		return t
+	}
+	return unknownTemperatureC
+}
+
+// runnerPodsPerNode counts the runner pods currently assigned to each node,
+// across all course namespaces.
+func runnerPodsPerNode(clientset kubernetes.Interface) (map[string]int, error) {
+	pods, err := clientset.CoreV1().Pods(meta.NamespaceAll).List(context.TODO(), meta.ListOptions{
+		LabelSelector: runnerRoleLabel + "=runner",
+	})
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, p := range pods.Items {
+		if p.Spec.NodeName == "" || p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		counts[p.Spec.NodeName]++
+	}
+	return counts, nil
+}
+
+// rankedNode is a candidate phone; lower cost is better.
+type rankedNode struct {
+	name string
+	cost float64
+}
+
+// rankNodes returns the healthy nodes best first, the degraded ones best
+// first, and every excluded node (degraded ones included) with its reason.
+// Benchmark runs only consider idle, healthy phones in their node pool.
+func rankNodes(clientset kubernetes.Interface, bench *BenchmarkConfig) (ranked, fallback []rankedNode, excluded map[string]string, err error) {
+	nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), meta.ListOptions{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	busy, err := runnerPodsPerNode(clientset)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	now := time.Now()
+	excluded = map[string]string{}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		// a hot phone and a busy phone are roughly equally bad: one extra job ~ 10C
+		candidate := rankedNode{name: node.Name, cost: nodeTemperature(node) + 10*float64(busy[node.Name])}
+		reason := exclusionReason(node, now)
+		if bench != nil {
+			if reason == "" {
+				reason = benchmarkExclusion(node, bench, busy[node.Name])
+			}
+		} else if degraded(reason) {
+			fallback = append(fallback, candidate)
+		}
+		if reason != "" {
+			excluded[node.Name] = reason
+			continue
+		}
+		ranked = append(ranked, candidate)
+	}
+	sortRanked(ranked)
+	sortRanked(fallback)
+	return ranked, fallback, excluded, nil
+}
+
+func sortRanked(nodes []rankedNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].cost != nodes[j].cost {
+			return nodes[i].cost < nodes[j].cost
+		}
+		return nodes[i].name < nodes[j].name
+	})
+}
+
+func benchmarkExclusion(node *corev1.Node, bench *BenchmarkConfig, busy int) string {
+	for k, v := range bench.NodeSelector {
+		if node.Labels[k] != v {
+			return "not in the benchmark node pool"
+		}
+	}
+	if busy > 0 {
+		return "busy, benchmarks need the whole phone"
+	}
+	return ""
+}
+
+// planPlacement chooses where the job should run. When every phone is
+// excluded it falls back to the least bad degraded ones; when none of those
+// can run it either, it returns errNoPhone and the job should stay queued.
+func planPlacement(clientset kubernetes.Interface, a *Assignment) (*PlacementDecision, error) {
+	d := &PlacementDecision{Mode: placementMode()}
+	if d.Mode == placementOff {
+		return d, nil
+	}
+	ranked, fallback, excluded, err := rankNodes(clientset, a.Benchmark)
+	if err != nil {
+		return nil, fmt.Errorf("placement: %v", err)
+	}
+	d.Excluded = excluded
+	if len(ranked) == 0 {
+		if len(fallback) == 0 {
+			d.Reason = "no phone can take the job, waiting in the queue"
+			return d, errNoPhone
+		}
+		ranked = fallback
+		d.Fallback = true
+		for _, n := range fallback {
+			delete(d.Excluded, n.name)
+		}
+	}
+
+	for i := 0; i < len(ranked) && i < 3; i++ {
+		d.Preferred = append(d.Preferred, ranked[i].name)
+	}
+	what := "healthy phone"
+	if d.Fallback {
+		what = "degraded phone, as no healthy one is left"
+	}
+	if d.Mode == placementNodeName {
+		d.NodeName = ranked[0].name
+		d.Reason = fmt.Sprintf("pinned to %s, the coolest and least busy %s", d.NodeName, what)
+		return d, nil
+	}
+	d.Reason = fmt.Sprintf("preferring %v, the coolest and least busy %s; avoiding %d phone(s)", d.Preferred, what, len(d.Excluded))
+	return d, nil
+}
+
+// applyPlacement applies a decision to the pod spec. Pinning also goes
+// through node affinity rather than spec.nodeName, so the scheduler still
+// checks the OpenCL resource and the benchmark anti-affinity.
+func applyPlacement(spec *corev1.PodSpec, d *PlacementDecision) {
+	switch {
+	case d == nil || d.Mode == placementOff:
+	case d.NodeName != "":
+		requireNode(spec, d.NodeName)
+	case len(d.Preferred) > 0:
+		applyPlacementAffinity(spec, d.Preferred, d.Excluded)
+	}
+}
+
+// requireNode restricts the pod to one node through required node affinity.
+func requireNode(spec *corev1.PodSpec, name string) {
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	spec.Affinity.NodeAffinity = &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchFields: []corev1.NodeSelectorRequirement{{
+					Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{name},
+				}},
+			}},
+		},
+	}
+}
+
+// applyPlacementAffinity forbids the excluded nodes and prefers the given
+// ones, best first, through node affinity on metadata.name.
+func applyPlacementAffinity(spec *corev1.PodSpec, preferred []string, excluded map[string]string) {
+	affinity := &corev1.NodeAffinity{}
+	if len(excluded) > 0 {
+		names := make([]string, 0, len(excluded))
+		for name := range excluded {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		affinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{
+			NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+				MatchFields: []corev1.NodeSelectorRequirement{{
+					Key: "metadata.name", Operator: corev1.NodeSelectorOpNotIn, Values: names,
+				}},
+			}},
+		}
+	}
+	weight := int32(100)
+	for _, name := range preferred {
+		affinity.PreferredDuringSchedulingIgnoredDuringExecution = append(affinity.PreferredDuringSchedulingIgnoredDuringExecution,
+			corev1.PreferredSchedulingTerm{
+				Weight: weight,
+				Preference: corev1.NodeSelectorTerm{
+					MatchFields: []corev1.NodeSelectorRequirement{{
+						Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{name},
+					}},
+				},
+			})
+		weight /= 2
+	}
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	spec.Affinity.NodeAffinity = affinity
+}
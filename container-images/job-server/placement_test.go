@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testNode returns a ready node with the given labels and temperature
+// annotation ("" for none).
+func testNode(name, temp string, labels map[string]string) *corev1.Node {
+	n := &corev1.Node{
+		ObjectMeta: meta.ObjectMeta{Name: name, Labels: labels, Annotations: map[string]string{}},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{{
+			Type: corev1.NodeReady, Status: corev1.ConditionTrue,
+		}}},
+	}
+	if temp != "" {
+		n.Annotations[annotationTemperature] = temp
+	}
+	return n
+}
+
+func runnerPod(name, node string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: meta.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{runnerRoleLabel: "runner"}},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func TestPlanPlacement(t *testing.T) {
+	notReady := testNode("pl-down", "30", nil)
+	notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+	cordoned := testNode("pl-cordoned", "30", nil)
+	cordoned.Spec.Unschedulable = true
+	hot := testNode("pl-hot", "60", map[string]string{labelThrottled: "true"})
+	low := testNode("pl-low", "35", map[string]string{labelBatteryLow: "true"})
+	lowCharging := testNode("pl-low-charging", "36", map[string]string{labelBatteryLow: "true", labelCharging: "true"})
+	cool := testNode("pl-cool", "30", nil)
+	busy := testNode("pl-busy", "28", nil)
+	unknown := testNode("pl-unknown", "", nil)
+
+	tests := []struct {
+		name      string
+		mode      string
+		bench     *BenchmarkConfig
+		objects   []runtime.Object
+		preferred []string
+		excluded  []string
+		fallback  bool
+		err       error
+	}{
+		{
+			name:      "healthy phones, coolest and least busy first",
+			objects:   []runtime.Object{notReady, cordoned, hot, low, lowCharging, cool, busy, unknown, runnerPod("p1", "pl-busy")},
+			preferred: []string{"pl-cool", "pl-low-charging", "pl-busy"},
+			excluded:  []string{"pl-cordoned", "pl-down", "pl-hot", "pl-low"},
+		},
+		{
+			name:      "only degraded phones left",
+			objects:   []runtime.Object{notReady, hot, low},
+			preferred: []string{"pl-low", "pl-hot"},
+			excluded:  []string{"pl-down"},
+			fallback:  true,
+		},
+		{
+			name:     "no phone can run anything",
+			objects:  []runtime.Object{notReady, cordoned},
+			excluded: []string{"pl-cordoned", "pl-down"},
+			err:      errNoPhone,
+		},
+		{
+			name:     "benchmarks never fall back",
+			bench:    &BenchmarkConfig{TimedCommand: "true"},
+			objects:  []runtime.Object{hot, busy, runnerPod("p1", "pl-busy")},
+			excluded: []string{"pl-busy", "pl-hot"},
+			err:      errNoPhone,
+		},
+		{
+			name:    "placement off",
+			mode:    placementOff,
+			objects: []runtime.Object{notReady},
+		},
+	}
+	for _, tt := range tests {
+		t.Setenv("PLACEMENT_MODE", tt.mode)
+		clientset := fake.NewSimpleClientset(tt.objects...)
+		d, err := planPlacement(clientset, &Assignment{Name: "t", Benchmark: tt.bench})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		var excluded []string
+		for name := range d.Excluded {
+			excluded = append(excluded, name)
+		}
+		sort.Strings(excluded)
+		if !reflect.DeepEqual(d.Preferred, tt.preferred) || !reflect.DeepEqual(excluded, tt.excluded) || d.Fallback != tt.fallback {
+			t.Errorf("%s: preferred %v excluded %v fallback %v, want %v %v %v",
+				tt.name, d.Preferred, excluded, d.Fallback, tt.preferred, tt.excluded, tt.fallback)
+		}
+	}
+}
+
+func TestApplyPlacementPinsThroughAffinity(t *testing.T) {
+	t.Setenv("PLACEMENT_MODE", placementNodeName)
+	clientset := fake.NewSimpleClientset(testNode("pin-a", "40", nil), testNode("pin-b", "30", nil))
+	d, err := planPlacement(clientset, &Assignment{Name: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec corev1.PodSpec
+	applyPlacement(&spec, d)
+	if spec.NodeName != "" {
+		t.Errorf("nodeName %q set, bypassing the scheduler", spec.NodeName)
+	}
+	req := spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if d.NodeName != "pin-b" || req == nil || !reflect.DeepEqual(req.NodeSelectorTerms[0].MatchFields[0].Values, []string{"pin-b"}) {
+		t.Errorf("pinned to %q with %+v, want required affinity on pin-b", d.NodeName, req)
+	}
+
+	t.Setenv("PLACEMENT_MODE", "")
+	d, err = planPlacement(clientset, &Assignment{Name: "t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec = corev1.PodSpec{}
+	applyPlacement(&spec, d)
+	pref := spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(pref) != 2 || pref[0].Preference.MatchFields[0].Values[0] != "pin-b" || pref[0].Weight <= pref[1].Weight {
+		t.Errorf("preferences %+v, want pin-b weighted above pin-a", pref)
+	}
+	applyPlacement(&spec, nil) // a failed plan leaves the spec alone
+}
+
+func TestRecordReadyFlapping(t *testing.T) {
+	node := testNode("flappy", "", nil)
+	start := time.Now()
+	states := []corev1.ConditionStatus{corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionTrue, corev1.ConditionFalse}
+	var flapping bool
+	for i, st := range states {
+		node.Status.Conditions[0].Status = st
+		flapping = recordReady(node, start.Add(time.Duration(i)*time.Minute))
+	}
+	if !flapping {
+		t.Error("three transitions within the window were not flagged")
+	}
+	if recordReady(node, start.Add(flapWindow+5*time.Minute)) {
+		t.Error("old transitions still count once they are outside the window")
+	}
+	if reason := exclusionReason(testNode("steady", "", nil), start); reason != "" {
+		t.Errorf("a steady ready node was excluded: %s", reason)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"greengrader/webserver/gradescope"
+)
+
+// PrecheckConfig is one cheap check the server runs on a submission before
+// it is queued, e.g. "kernel.cl must define vecAdd".
+type PrecheckConfig struct {
+	Name  string `json:"name,omitempty"` // shown to the student; defaults to Check
+	Check string `json:"check"`          // name a Precheck registered itself under
+	// Files is a glob (see globMatch) selecting the archive entries checked;
+	// empty selects every file.
+	Files  string            `json:"files,omitempty"`
+	Params map[string]string `json:"params,omitempty"` // check specific settings
+	// Severity is "error" (default), which refuses the submission, or
+	// "warning", which grades it and adds the finding to its results.
+	Severity string `json:"severity,omitempty"`
+}
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// Precheck inspects the selected files of a submission. Files are keyed by
+// their path in the archive. Check returns one message per problem found.
+type Precheck interface {
+	Validate(params map[string]string) error
+	Check(files map[string][]byte, params map[string]string) []string
+}
+
+var prechecks = map[string]Precheck{}
+
+// registerPrecheck is called from init() for each kind of check.
+func registerPrecheck(name string, c Precheck) {
+	if _, dup := prechecks[name]; dup {
+		panic("pre-check registered twice: " + name)
+	}
+	prechecks[name] = c
+}
+
+func init() {
+	registerPrecheck("regex", regexPrecheck{})
+	registerPrecheck("file", filePrecheck{})
+}
+
+func (c *PrecheckConfig) name() string {
+	if c.Name == "" {
+		return c.Check
+	}
+	return c.Name
+}
+
+func (c *PrecheckConfig) validate() error {
+	p, ok := prechecks[c.Check]
+	if !ok {
+		return fmt.Errorf("unknown pre-check %q", c.Check)
+	}
+	if c.Severity != "" && c.Severity != severityError && c.Severity != severityWarning {
+		return fmt.Errorf("pre-check %s: unknown severity %q", c.name(), c.Severity)
+	}
+	if err := p.Validate(c.Params); err != nil {
+		return fmt.Errorf("pre-check %s: %v", c.name(), err)
+	}
+	return nil
+}
+
+// precheckFinding is a problem reported by one of an assignment's pre-checks.
+type precheckFinding struct {
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (f precheckFinding) String() string {
+	return f.Check + ": " + f.Message
+}
+
+// runPrechecks runs the assignment's pre-checks on a validated archive and
+// splits what they found into errors and warnings.
+func runPrechecks(checks []PrecheckConfig, data []byte) (errors, warnings []precheckFinding) {
+	if len(checks) == 0 {
+		return nil, nil
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return []precheckFinding{{Check: "archive", Severity: severityError, Message: err.Error()}}, nil
+	}
+	contents := map[string][]byte{} // read each entry at most once
+	for _, c := range checks {
+		files := map[string][]byte{}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() || c.Files != "" && !globMatch(c.Files, f.Name) {
+				continue
+			}
+			if _, ok := contents[f.Name]; !ok {
+				rc, err := f.Open()
+				if err != nil {
+					continue
+				}
+				contents[f.Name], _ = io.ReadAll(rc)
+				rc.Close()
+			}
+			files[f.Name] = contents[f.Name]
+		}
+		p, ok := prechecks[c.Check]
+		if !ok {
+			continue // rejected by validate
+		}
+		for _, msg := range p.Check(files, c.Params) {
+			f := precheckFinding{Check: c.name(), Severity: c.Severity, Message: msg}
+			if f.Severity == severityWarning {
+				warnings = append(warnings, f)
+			} else {
+				f.Severity = severityError
+				errors = append(errors, f)
+			}
+		}
+	}
+	return errors, warnings
+}
+
+// precheckResults is the results.json sent back for a submission refused by
+// its pre-checks, with a failed test per finding.
+func precheckResults(errors, warnings []precheckFinding) []byte {
+	zero := 0.0
+	res := gradescope.Results{
+		Score:  &zero,
+		Output: "Your submission was not graded because it failed the assignment's pre-checks.",
+	}
+	for _, f := range append(errors, warnings...) {
+		res.Tests = append(res.Tests, gradescope.Test{
+			Name:   "Pre-check: " + f.Check,
+			Status: gradescope.Failed,
+			Output: f.Message,
+			Tags:   []string{f.Severity},
+		})
+	}
+	data, _ := json.Marshal(res)
+	return data
+}
+
+// attachWarnings adds pre-check warnings to the output of a job's results.
+func attachWarnings(results []byte, warnings []precheckFinding) []byte {
+	if len(warnings) == 0 {
+		return results
+	}
+	res, err := parseRawResults(results)
+	if err != nil {
+		return results
+	}
+	if res.Output != "" {
+		res.Output += "\n\n"
+	}
+	res.Output += "Pre-check warnings:"
+	for _, f := range warnings {
+		res.Output += "\n- " + f.String()
+	}
+	data, err := res.marshal()
+	if err != nil {
+		return results
+	}
+	return data
+}
+
+// regexPrecheck looks for params["pattern"] in every selected file. With
+// params["mode"] "require" (default) each file must contain a match, and at
+// least one file must be selected; with "forbid" none may.
+type regexPrecheck struct{}
+
+func (regexPrecheck) Validate(params map[string]string) error {
+	if _, err := regexp.Compile(params["pattern"]); err != nil || params["pattern"] == "" {
+		return fmt.Errorf("needs a valid pattern")
+	}
+	switch params["mode"] {
+	case "", "require", "forbid":
+		return nil
+	}
+	return fmt.Errorf("mode must be require or forbid")
+}
+
+func (regexPrecheck) Check(files map[string][]byte, params map[string]string) []string {
+	re := regexp.MustCompile(params["pattern"]) // checked by Validate
+	forbid := params["mode"] == "forbid"
+	if !forbid && len(files) == 0 {
+		return []string{"no file to check was found in the submission"}
+	}
+	var found []string
+	for _, name := range sortedNames(files) {
+		loc := re.FindIndex(files[name])
+		switch {
+		case forbid && loc != nil:
+			line := bytes.Count(files[name][:loc[0]], []byte("\n")) + 1
+			found = append(found, fmt.Sprintf("%s:%d contains %q, which is not allowed", name, line, files[name][loc[0]:loc[1]]))
+		case !forbid && loc == nil:
+			found = append(found, fmt.Sprintf("%s does not match %s", name, params["pattern"]))
+		}
+	}
+	return found
+}
+
+// filePrecheck checks the selected files themselves: params["exists"]
+// "true" requires at least one, params["max_bytes"] and params["min_bytes"]
+// bound the size of each.
+type filePrecheck struct{}
+
+func (filePrecheck) Validate(params map[string]string) error {
+	for _, key := range []string{"max_bytes", "min_bytes"} {
+		if v, ok := params[key]; ok {
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				return fmt.Errorf("%s must be a byte count", key)
+			}
+		}
+	}
+	return nil
+}
+
+func (filePrecheck) Check(files map[string][]byte, params map[string]string) []string {
+	var found []string
+	if params["exists"] == "true" && len(files) == 0 {
+		found = append(found, "a required file is missing from the submission")
+	}
+	maxBytes, hasMax := params["max_bytes"]
+	minBytes, hasMin := params["min_bytes"]
+	for _, name := range sortedNames(files) {
+		size := len(files[name])
+		if n, _ := strconv.Atoi(maxBytes); hasMax && size > n {
+			found = append(found, fmt.Sprintf("%s is %d bytes; the limit is %d", name, size, n))
+		}
+		if n, _ := strconv.Atoi(minBytes); hasMin && size < n {
+			found = append(found, fmt.Sprintf("%s is %d bytes; it should be at least %d", name, size, n))
+		}
+	}
+	return found
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describePrechecks lists findings for logs and job records.
+func describePrechecks(findings []precheckFinding) string {
+	parts := make([]string, len(findings))
+	for i, f := range findings {
+		parts[i] = f.String()
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+
+	"greengrader/webserver/gradescope"
+)
+
+func TestPrecheckValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PrecheckConfig
+		wantErr bool
+	}{
+		{"regex", PrecheckConfig{Check: "regex", Params: map[string]string{"pattern": `__kernel\s+void\s+vecAdd`}}, false},
+		{"regex forbid", PrecheckConfig{Check: "regex", Params: map[string]string{"pattern": "system\\(", "mode": "forbid"}}, false},
+		{"regex without a pattern", PrecheckConfig{Check: "regex"}, true},
+		{"regex that does not compile", PrecheckConfig{Check: "regex", Params: map[string]string{"pattern": "("}}, true},
+		{"regex with an unknown mode", PrecheckConfig{Check: "regex", Params: map[string]string{"pattern": "x", "mode": "maybe"}}, true},
+		{"file", PrecheckConfig{Check: "file", Params: map[string]string{"exists": "true", "max_bytes": "1024", "min_bytes": "0"}}, false},
+		{"file with a bad size", PrecheckConfig{Check: "file", Params: map[string]string{"max_bytes": "1k"}}, true},
+		{"file with a negative size", PrecheckConfig{Check: "file", Params: map[string]string{"min_bytes": "-1"}}, true},
+		{"warning", PrecheckConfig{Check: "file", Severity: severityWarning}, false},
+		{"unknown severity", PrecheckConfig{Check: "file", Severity: "fatal"}, true},
+		{"unknown check", PrecheckConfig{Check: "lint"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPrecheckChecks(t *testing.T) {
+	files := map[string][]byte{
+		"kernel.cl": []byte("// vector add\n__kernel void vecAdd(__global float *a) {}\n"),
+		"main.c":    []byte("#include <stdlib.h>\nint main() {\n  system(\"rm -rf /\");\n}\n"),
+		"empty.txt": nil,
+	}
+	only := func(names ...string) map[string][]byte {
+		out := map[string][]byte{}
+		for _, n := range names {
+			out[n] = files[n]
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		check  Precheck
+		files  map[string][]byte
+		params map[string]string
+		want   []string
+	}{
+		{"regex finds the kernel", regexPrecheck{}, only("kernel.cl"), map[string]string{"pattern": `__kernel\s+void\s+vecAdd`}, nil},
+		{"regex requires every file to match", regexPrecheck{}, only("kernel.cl", "main.c"), map[string]string{"pattern": "vecAdd"},
+			[]string{"main.c does not match vecAdd"}},
+		{"regex requires a file", regexPrecheck{}, only(), map[string]string{"pattern": "x"},
+			[]string{"no file to check was found in the submission"}},
+		{"regex forbid reports the line", regexPrecheck{}, only("kernel.cl", "main.c"), map[string]string{"pattern": `system\(`, "mode": "forbid"},
+			[]string{`main.c:3 contains "system(", which is not allowed`}},
+		{"regex forbid with no files", regexPrecheck{}, only(), map[string]string{"pattern": "x", "mode": "forbid"}, nil},
+		{"file exists", filePrecheck{}, only("main.c"), map[string]string{"exists": "true"}, nil},
+		{"file missing", filePrecheck{}, only(), map[string]string{"exists": "true"},
+			[]string{"a required file is missing from the submission"}},
+		{"file sizes", filePrecheck{}, only("kernel.cl", "empty.txt"), map[string]string{"max_bytes": "20", "min_bytes": "1"},
+			[]string{"empty.txt is 0 bytes; it should be at least 1", "kernel.cl is 57 bytes; the limit is 20"}},
+	}
+	for _, tt := range tests {
+		if got := tt.check.Check(tt.files, tt.params); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunPrechecks(t *testing.T) {
+	data := testZip(t,
+		zipEntry{name: "src/", mode: fs.ModeDir | 0o755},
+		zipEntry{name: "src/kernel.cl", contents: "__kernel void vecAdd() {}"},
+		zipEntry{name: "src/main.c", contents: "int main() { return 0; }"},
+		zipEntry{name: "README.md", contents: "TODO"},
+	)
+	checks := []PrecheckConfig{
+		{Name: "kernel defines vecAdd", Check: "regex", Files: "*.cl", Params: map[string]string{"pattern": "vecAdd"}},
+		{Name: "report present", Check: "file", Files: "*REPORT.pdf", Params: map[string]string{"exists": "true"}},
+		{Name: "no TODOs", Check: "regex", Severity: severityWarning, Params: map[string]string{"pattern": "TODO", "mode": "forbid"}},
+	}
+	errs, warnings := runPrechecks(checks, data)
+	if len(errs) != 1 || errs[0].Check != "report present" || errs[0].Severity != severityError {
+		t.Errorf("errors %+v, want the missing report", errs)
+	}
+	if len(warnings) != 1 || warnings[0].Check != "no TODOs" || !strings.HasPrefix(warnings[0].Message, "README.md:1") {
+		t.Errorf("warnings %+v, want the TODO in README.md", warnings)
+	}
+	if errs, warnings := runPrechecks(nil, []byte("not a zip")); errs != nil || warnings != nil {
+		t.Errorf("no checks still found %v %v", errs, warnings)
+	}
+
+	var res gradescope.Results
+	if err := json.Unmarshal(precheckResults(errs, warnings), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalScore() != 0 || len(res.Tests) != 2 || res.Tests[0].Name != "Pre-check: report present" || res.Tests[1].Tags[0] != severityWarning {
+		t.Errorf("precheck results %+v", res)
+	}
+
+	out := attachWarnings([]byte(`{"score": 7, "output": "ok", "n_time": 3}`), warnings)
+	res = gradescope.Results{}
+	if err := json.Unmarshal(out, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalScore() != 7 || !strings.Contains(res.Output, "ok\n\nPre-check warnings:\n- no TODOs: README.md:1") || !strings.Contains(string(out), `"n_time":3`) {
+		t.Errorf("attachWarnings = %s", out)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Submission priorities, highest first.
+const (
+	priorityStudent = "student" // interactive student submissions
+	priorityStaff   = "staff"   // instructor and TA test runs
+	priorityBulk    = "bulk"    // regrades and other background work
+)
+
+// priorityClasses maps each priority onto the Kubernetes PriorityClass its
+// runner pods use, so the scheduler also favours (and preempts for) them.
+var priorityClasses = map[string]schedulingv1.PriorityClass{
+	priorityStudent: {
+		ObjectMeta:  meta.ObjectMeta{Name: "greengrader-student"},
+		Value:       1000,
+		Description: "Interactive student submissions",
+	},
+	priorityStaff: {
+		ObjectMeta:  meta.ObjectMeta{Name: "greengrader-staff"},
+		Value:       500,
+		Description: "Instructor and TA test runs",
+	},
+	priorityBulk: {
+		ObjectMeta:  meta.ObjectMeta{Name: "greengrader-bulk"},
+		Value:       100,
+		Description: "Bulk regrades and background work",
+	},
+}
+
+// priorityClassesReady is set once the PriorityClasses are known to exist;
+// until then pods are created without a priorityClassName.
+var priorityClassesReady bool
+
+func validPriority(p string) bool {
+	_, ok := priorityClasses[p]
+	return ok
+}
+
+// priorityRank orders priorities for the server's queue; higher runs first.
+func priorityRank(p string) int {
+	return int(priorityClasses[p].Value)
+}
+
+// priorityPreemptible reports whether runs of this priority may be stopped
+// and requeued for higher-priority work. Student runs are never preempted.
+func priorityPreemptible(p string) bool {
+	return p != priorityStudent
+}
+
+// ensurePriorityClasses creates any missing PriorityClasses.
+func ensurePriorityClasses(clientset kubernetes.Interface) {
+	for _, pc := range priorityClasses {
+		_, err := clientset.SchedulingV1().PriorityClasses().Create(context.TODO(), &pc, meta.CreateOptions{})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			log.Printf("Failed to create PriorityClass %s, runner pods will use the default priority: %v", pc.Name, err)
+			return
+		}
+	}
+	priorityClassesReady = true
+}
+
+// applyPriority sets the pod's PriorityClass.
+func applyPriority(spec *corev1.PodSpec, priority string) {
+	if !priorityClassesReady {
+		return
+	}
+	spec.PriorityClassName = priorityClasses[priority].Name
+}
+
+// applyPodFailurePolicy lets preemptible runs survive the scheduler preempting
+// their pod: the DisruptionTarget failure is ignored, so the Job controller
+// starts a new pod instead of reporting the run as failed.
+func applyPodFailurePolicy(job *batchv1.Job, priority string) {
+	if !priorityPreemptible(priority) {
+		return
+	}
+	job.Spec.PodFailurePolicy = &batchv1.PodFailurePolicy{
+		Rules: []batchv1.PodFailurePolicyRule{{
+			Action: batchv1.PodFailurePolicyActionIgnore,
+			OnPodConditions: []batchv1.PodFailurePolicyOnPodConditionsPattern{{
+				Type:   corev1.DisruptionTarget,
+				Status: corev1.ConditionTrue,
+			}},
+		}},
+	}
+}
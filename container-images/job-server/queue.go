@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// queuedJob is a submission waiting for, or holding, a run slot.
+type queuedJob struct {
+	id         string
+	assignment *Assignment
+	archive    string // hash in the archive store, read when the job is dispatched
+	priority   string
+	tenant     string
+	enqueued   time.Time
+	started    time.Time // when it last got a run slot
+
+	// attempt counts preemptions; it is part of the Kubernetes object names so
+	// a requeued run never collides with the cleanup of the previous one.
+	attempt   int
+	preempted bool
+	// namespace is where the attempt runs. It is fixed at dispatch, so a
+	// course moved to another namespace cannot strand its running jobs.
+	namespace string
+
+	charged     bool      // its dispatch was paid for from its tenant's deficit
+	parkedUntil time.Time // no phone could take it; not considered again before this
+}
+
+// parkTime is how long a job no phone could take waits before it is retried.
+const parkTime = 15 * time.Second
+
+// ready reports whether j may be dispatched now.
+func (j *queuedJob) ready(now time.Time) bool {
+	return !now.Before(j.parkedUntil)
+}
+
+func (j *queuedJob) k8sName() string {
+	if j.attempt == 0 {
+		return j.id
+	}
+	return fmt.Sprintf("%s-r%d", j.id, j.attempt)
+}
+
+// jobQueue holds waiting submissions and tracks the running ones.
+type jobQueue struct {
+	mu      sync.Mutex
+	waiting []*queuedJob
+	running map[string]*queuedJob // by k8sName, one entry per attempt
+	wake    chan struct{}
+
+	// deficit round-robin state across tenants (see pickTenant)
+	deficit map[string]float64
+	current string
+
+	// reserved holds waiting jobs a preemption freed a slot for; they get
+	// the next free slot ahead of the round-robin.
+	reserved map[string]bool
+}
+
+func newJobQueue() *jobQueue {
+	return &jobQueue{
+		running:  map[string]*queuedJob{},
+		wake:     make(chan struct{}, 1),
+		deficit:  map[string]float64{},
+		reserved: map[string]bool{},
+	}
+}
+
+var queue = newJobQueue()
+
+// maxRunningJobs is how many grading jobs may run at once (MAX_RUNNING_JOBS, default 16: one per phone).
+func maxRunningJobs() int {
+	if n, err := strconv.Atoi(os.Getenv("MAX_RUNNING_JOBS")); err == nil && n > 0 {
+		return n
+	}
+	return 16
+}
+
+func (q *jobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *jobQueue) push(j *queuedJob) {
+	q.mu.Lock()
+	q.waiting = append(q.waiting, j)
+	q.mu.Unlock()
+	q.notify()
+}
+
+// bestWaiting returns the index of the most urgent waiting job, optionally
+// only among the given tenant's: highest priority first, then oldest.
+// Parked jobs are skipped.
+func (q *jobQueue) bestWaiting(tenant string) int {
+	best := -1
+	now := time.Now()
+	for i, j := range q.waiting {
+		if tenant != "" && j.tenant != tenant || !j.ready(now) {
+			continue
+		}
+		if best < 0 || priorityRank(j.priority) > priorityRank(q.waiting[best].priority) ||
+			priorityRank(j.priority) == priorityRank(q.waiting[best].priority) && j.enqueued.Before(q.waiting[best].enqueued) {
+			best = i
+		}
+	}
+	return best
+}
+
+// next pops the next job to run if there is a free slot. A job that
+// preempted another run goes first; otherwise the tenant is chosen by fair
+// share, then its most urgent job runs.
+func (q *jobQueue) next(slots int) *queuedJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.running) >= slots {
+		return nil
+	}
+	charged := false
+	i := q.reservedWaiting()
+	if i < 0 {
+		var tenant string
+		tenant, charged = q.pickTenant()
+		i = q.bestWaiting(tenant)
+	}
+	if i < 0 {
+		return nil
+	}
+	j := q.waiting[i]
+	q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+	delete(q.reserved, j.id)
+	j.started = time.Now()
+	j.charged = charged
+	q.running[j.k8sName()] = j
+	return j
+}
+
+// reservedWaiting returns the index of the most urgent ready job holding a
+// reservation, or -1.
+func (q *jobQueue) reservedWaiting() int {
+	best := -1
+	now := time.Now()
+	for i, j := range q.waiting {
+		if !q.reserved[j.id] || !j.ready(now) {
+			continue
+		}
+		if best < 0 || priorityRank(j.priority) > priorityRank(q.waiting[best].priority) ||
+			priorityRank(j.priority) == priorityRank(q.waiting[best].priority) && j.enqueued.Before(q.waiting[best].enqueued) {
+			best = i
+		}
+	}
+	return best
+}
+
+// requeue puts a job no phone could take back in the queue, at its original
+// place, refunds its tenant's deficit and parks it for parkTime.
+func (q *jobQueue) requeue(j *queuedJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.running, j.k8sName())
+	if j.charged {
+		q.deficit[j.tenant]++
+		j.charged = false
+	}
+	j.started = time.Time{}
+	j.parkedUntil = time.Now().Add(parkTime)
+	q.waiting = append(q.waiting, j)
+}
+
+func (q *jobQueue) runningCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.running)
+}
+
+// preemptionVictim picks a running job to make room for a waiting one of
+// higher priority: the lowest priority, most recently enqueued run. The
+// freed slot is reserved for the waiting job.
+func (q *jobQueue) preemptionVictim(slots int) *queuedJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.running) < slots {
+		return nil
+	}
+	i := q.bestWaiting("")
+	if i < 0 {
+		return nil
+	}
+	want := priorityRank(q.waiting[i].priority)
+	var victim *queuedJob
+	for _, j := range q.running {
+		if priorityRank(j.priority) >= want || !priorityPreemptible(j.priority) {
+			continue
+		}
+		if victim == nil || priorityRank(j.priority) < priorityRank(victim.priority) ||
+			priorityRank(j.priority) == priorityRank(victim.priority) && j.enqueued.After(victim.enqueued) {
+			victim = j
+		}
+	}
+	if victim != nil {
+		victim.preempted = true
+		delete(q.running, victim.k8sName())
+		q.reserved[q.waiting[i].id] = true
+	}
+	return victim
+}
+
+// finish releases j's slot, reporting whether j was still the current run.
+// A run that was preempted meanwhile has already given its slot up, and its
+// requeued attempt may be running; it must not touch the job record.
+func (q *jobQueue) finish(j *queuedJob) bool {
+	q.mu.Lock()
+	current := q.running[j.k8sName()] == j
+	if current {
+		delete(q.running, j.k8sName())
+	}
+	q.mu.Unlock()
+	if !current {
+		return false
+	}
+	recordRelease(j, true, time.Now())
+	q.notify()
+	return true
+}
+
+// wasPreempted reports whether the run was taken off the cluster to make room.
+func (q *jobQueue) wasPreempted(j *queuedJob) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return j.preempted
+}
+
+// remove takes a waiting job out of the queue, reporting whether it was still waiting.
+func (q *jobQueue) remove(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.reserved, id)
+	for i, j := range q.waiting {
+		if j.id == id {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// position returns how many waiting jobs will run before id, or -1. It
+// ignores fair share between tenants, so it is an estimate.
+func (q *jobQueue) position(id string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var target *queuedJob
+	for _, j := range q.waiting {
+		if j.id == id {
+			target = j
+		}
+	}
+	if target == nil {
+		return -1
+	}
+	ahead := 0
+	for _, j := range q.waiting {
+		r, t := priorityRank(j.priority), priorityRank(target.priority)
+		if r > t || r == t && j.enqueued.Before(target.enqueued) {
+			ahead++
+		}
+	}
+	return ahead
+}
+
+// dispatch starts queued jobs as slots free up and preempts lower-priority
+// runs when higher-priority submissions are waiting.
+func dispatch(clientset kubernetes.Interface) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		slots := maxRunningJobs()
+		for {
+			j := queue.next(slots)
+			if j == nil {
+				break
+			}
+			err := startJob(clientset, j)
+			if errors.Is(err, errNoPhone) {
+				// wait for a phone to recover instead of failing the job
+				queue.requeue(j)
+				continue
+			}
+			recordDispatch(j, j.started)
+			if err != nil {
+				log.Printf("Job %s: %v", j.id, err)
+				updateJob(j.id, func(r *JobRecord) {
+					r.Status = statusFailed
+					r.Error = err.Error()
+					r.Results = errorResults("The grading server could not start your job: "+err.Error(), nil)
+				})
+				queue.finish(j)
+			}
+		}
+		if victim := queue.preemptionVictim(slots); victim != nil {
+			preempt(clientset, victim)
+			continue
+		}
+		select {
+		case <-queue.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// preempt deletes the victim's Job and puts it back in the queue.
+func preempt(clientset kubernetes.Interface, j *queuedJob) {
+	log.Printf("Preempting %s (%s priority) for a higher priority submission", j.k8sName(), j.priority)
+	propagation := meta.DeletePropagationBackground
+	err := clientset.BatchV1().Jobs(j.namespace).Delete(context.TODO(), j.k8sName(), meta.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil {
+		log.Printf("Error deleting preempted Job %s: %v", j.k8sName(), err)
+	}
+	recordRelease(j, false, time.Now())
+	requeued := &queuedJob{
+		id:         j.id,
+		assignment: j.assignment,
+		archive:    j.archive,
+		priority:   j.priority,
+		tenant:     j.tenant,
+		enqueued:   j.enqueued,
+		attempt:    j.attempt + 1,
+	}
+	updateJob(j.id, func(r *JobRecord) {
+		r.Status = statusQueued
+		r.Placement = nil
+		r.Preemptions++
+	})
+	queue.push(requeued)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// withTenants replaces the tenant table for the duration of a test.
+func withTenants(t *testing.T, table map[string]*Tenant) {
+	t.Helper()
+	configMutex.Lock()
+	saved := tenants
+	tenants = table
+	configMutex.Unlock()
+	t.Cleanup(func() {
+		configMutex.Lock()
+		tenants = saved
+		configMutex.Unlock()
+	})
+}
+
+// fill queues n jobs of the tenant at the given priority, enqueued in order.
+func fill(q *jobQueue, tenant, priority string, n int, base time.Time) {
+	for i := 0; i < n; i++ {
+		q.push(&queuedJob{
+			id:       fmt.Sprintf("%s-%s-%d", tenant, priority, i),
+			priority: priority,
+			tenant:   tenant,
+			enqueued: base.Add(time.Duration(i) * time.Second),
+		})
+	}
+}
+
+// drain dispatches up to n jobs one slot at a time, finishing each before
+// the next, and returns the tenants in dispatch order.
+func drain(q *jobQueue, n int) []string {
+	var order []string
+	for i := 0; i < n; i++ {
+		j := q.next(1)
+		if j == nil {
+			break
+		}
+		order = append(order, j.tenant)
+		q.mu.Lock()
+		delete(q.running, j.k8sName())
+		q.mu.Unlock()
+	}
+	return order
+}
+
+func count(order []string) map[string]int {
+	out := map[string]int{}
+	for _, t := range order {
+		out[t]++
+	}
+	return out
+}
+
+func TestDeficitRoundRobinShares(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		jobs    map[string]int
+		n       int
+		want    map[string]int
+	}{
+		{"equal weights alternate", map[string]float64{"a": 1, "b": 1}, map[string]int{"a": 10, "b": 10}, 10, map[string]int{"a": 5, "b": 5}},
+		{"weights share by ratio", map[string]float64{"a": 2, "b": 1}, map[string]int{"a": 20, "b": 20}, 12, map[string]int{"a": 8, "b": 4}},
+		{"fractional weights", map[string]float64{"a": 0.5, "b": 1.5}, map[string]int{"a": 20, "b": 20}, 8, map[string]int{"a": 2, "b": 6}},
+		{"idle tenant does not hold slots", map[string]float64{"a": 1, "b": 3}, map[string]int{"a": 5}, 5, map[string]int{"a": 5}},
+		{"tenant that runs out yields", map[string]float64{"a": 1, "b": 1}, map[string]int{"a": 2, "b": 6}, 8, map[string]int{"a": 2, "b": 6}},
+	}
+	for _, tt := range tests {
+		table := map[string]*Tenant{}
+		for name, w := range tt.weights {
+			table[name] = &Tenant{Name: name, Weight: w}
+		}
+		withTenants(t, table)
+		q := newJobQueue()
+		base := time.Now().Add(-time.Hour)
+		for tenant, n := range tt.jobs {
+			fill(q, tenant, priorityStudent, n, base)
+		}
+		got := count(drain(q, tt.n))
+		for tenant, want := range tt.want {
+			if got[tenant] != want {
+				t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMinSlotsGoFirst(t *testing.T) {
+	withTenants(t, map[string]*Tenant{
+		"big":   {Name: "big", Weight: 10},
+		"small": {Name: "small", Weight: 1, MinSlots: 2},
+	})
+	q := newJobQueue()
+	base := time.Now().Add(-time.Hour)
+	fill(q, "big", priorityStudent, 5, base)
+	fill(q, "small", priorityStudent, 5, base)
+	var order []string
+	for i := 0; i < 3; i++ {
+		order = append(order, q.next(10).tenant) // keep them running
+	}
+	if order[0] != "small" || order[1] != "small" || order[2] != "big" {
+		t.Errorf("dispatch order %v, want small twice before big", order)
+	}
+}
+
+func TestPriorityBeforeFairShare(t *testing.T) {
+	withTenants(t, map[string]*Tenant{"a": {Name: "a", Weight: 100}, "b": {Name: "b", Weight: 1}})
+	q := newJobQueue()
+	base := time.Now().Add(-time.Hour)
+	fill(q, "a", priorityBulk, 3, base)
+	fill(q, "b", priorityStaff, 1, base.Add(time.Minute))
+	fill(q, "b", priorityStudent, 1, base.Add(2*time.Minute))
+	var got []string
+	for j := q.next(10); j != nil; j = q.next(10) {
+		got = append(got, j.priority)
+	}
+	want := []string{priorityStudent, priorityStaff, priorityBulk, priorityBulk, priorityBulk}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("dispatch order %v, want %v", got, want)
+	}
+}
+
+func TestPreemptedSlotIsReserved(t *testing.T) {
+	withTenants(t, map[string]*Tenant{"a": {Name: "a"}, "b": {Name: "b"}, "c": {Name: "c"}})
+	q := newJobQueue()
+	base := time.Now().Add(-time.Hour)
+	fill(q, "a", priorityBulk, 1, base)
+	fill(q, "c", priorityStudent, 1, base.Add(time.Second))
+	if j := q.next(2); j == nil || j.tenant != "c" {
+		t.Fatalf("first dispatch = %+v", j)
+	}
+	if j := q.next(2); j == nil || j.tenant != "a" {
+		t.Fatalf("second dispatch = %+v", j)
+	}
+
+	// Two student jobs wait; b's arrived first, but the round-robin favours
+	// c. The preemption is for b's job.
+	fill(q, "c", priorityStudent, 1, base.Add(2*time.Second))
+	q.waiting[0].id = "c-late"
+	q.waiting[0].enqueued = base.Add(time.Minute)
+	fill(q, "b", priorityStudent, 1, base.Add(30*time.Second))
+	q.current = "b"
+	q.deficit["c"] = 5
+
+	victim := q.preemptionVictim(2)
+	if victim == nil || victim.tenant != "a" {
+		t.Fatalf("victim = %+v, want the bulk run", victim)
+	}
+	if j := q.next(2); j == nil || j.tenant != "b" {
+		t.Errorf("the freed slot went to %+v, want the job that caused the preemption", j)
+	}
+	if len(q.reserved) != 0 {
+		t.Errorf("reservation left behind: %v", q.reserved)
+	}
+	if victim := q.preemptionVictim(2); victim != nil {
+		t.Errorf("student run %s was preempted", victim.id)
+	}
+}
+
+func TestPreemptedRunCannotFinish(t *testing.T) {
+	withTenants(t, map[string]*Tenant{"a": {Name: "a"}})
+	q := newJobQueue()
+	base := time.Now().Add(-time.Hour)
+	fill(q, "a", priorityBulk, 1, base)
+	old := q.next(1)
+	fill(q, "a", priorityStaff, 1, base.Add(time.Second))
+	if victim := q.preemptionVictim(1); victim != old {
+		t.Fatalf("victim = %+v, want the bulk run", victim)
+	}
+	if staff := q.next(1); staff == nil || !q.finish(staff) {
+		t.Fatal("the staff run did not take and release the slot")
+	}
+
+	// The requeued attempt of the bulk run is running when the preempted
+	// attempt's monitor gets to finish it.
+	q.push(&queuedJob{id: old.id, priority: old.priority, tenant: old.tenant, enqueued: old.enqueued, attempt: old.attempt + 1})
+	requeued := q.next(1)
+	if requeued == nil || requeued.k8sName() == old.k8sName() {
+		t.Fatalf("requeued attempt = %+v", requeued)
+	}
+	if q.finish(old) {
+		t.Error("the preempted attempt finished as if it were current")
+	}
+	if q.runningCount() != 1 {
+		t.Errorf("the preempted attempt released the requeued one's slot")
+	}
+	if !q.finish(requeued) || q.runningCount() != 0 {
+		t.Error("the requeued attempt could not finish")
+	}
+}
+
+func TestPreemptUsesTheDispatchNamespace(t *testing.T) {
+	withJobs(t)
+	withTenants(t, map[string]*Tenant{"cse160": {Name: "cse160", Namespace: "cse160-moved"}})
+	j := &queuedJob{id: "run", tenant: "cse160", priority: priorityBulk, namespace: "cse160"}
+	clientset := fake.NewSimpleClientset(&batchv1.Job{ObjectMeta: meta.ObjectMeta{Name: j.k8sName(), Namespace: "cse160"}})
+	putJob(&JobRecord{ID: j.id, Tenant: "cse160", Status: statusPending, Namespace: "cse160"})
+
+	preempt(clientset, j)
+	if _, err := clientset.BatchV1().Jobs("cse160").Get(context.TODO(), j.k8sName(), meta.GetOptions{}); err == nil {
+		t.Error("the preempted Job is still running in the namespace it was dispatched to")
+	}
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if len(queue.waiting) != 1 || queue.waiting[0].namespace != "" || queue.waiting[0].attempt != 1 {
+		t.Errorf("requeued %+v, want a new attempt whose namespace is chosen at its dispatch", queue.waiting)
+	}
+}
+
+func TestRemoveDropsReservation(t *testing.T) {
+	q := newJobQueue()
+	fill(q, "a", priorityStudent, 1, time.Now())
+	q.reserved["a-student-0"] = true
+	if !q.remove("a-student-0") || len(q.reserved) != 0 {
+		t.Errorf("remove kept the reservation: %v", q.reserved)
+	}
+	if q.remove("a-student-0") {
+		t.Error("removed a job twice")
+	}
+}
+
+func TestRequeueParksAndRefunds(t *testing.T) {
+	withTenants(t, map[string]*Tenant{"a": {Name: "a"}, "b": {Name: "b"}})
+	q := newJobQueue()
+	base := time.Now().Add(-time.Hour)
+	fill(q, "a", priorityStudent, 1, base)
+	fill(q, "b", priorityStudent, 1, base.Add(time.Second))
+	j := q.next(1)
+	if j == nil {
+		t.Fatal("nothing dispatched")
+	}
+	deficit := q.deficit[j.tenant]
+	q.requeue(j)
+	if j.charged && q.deficit[j.tenant] != deficit+1 {
+		t.Errorf("deficit %g after requeue, want %g", q.deficit[j.tenant], deficit+1)
+	}
+	other := q.next(1)
+	if other == nil || other.id == j.id {
+		t.Fatalf("the parked job was dispatched again right away: %+v", other)
+	}
+	q.finish(other)
+	if q.next(1) != nil {
+		t.Error("a parked job was dispatched before its park time")
+	}
+	q.mu.Lock()
+	j.parkedUntil = time.Now().Add(-time.Second)
+	q.mu.Unlock()
+	if again := q.next(1); again == nil || again.id != j.id {
+		t.Errorf("after its park time the job was not dispatched: %+v", again)
+	}
+	if q.position(j.id) != -1 {
+		t.Error("a running job still has a queue position")
+	}
+}
+
+func TestTenantUsage(t *testing.T) {
+	stateMutex.Lock()
+	saved := state
+	state = latencyState{}
+	stateMutex.Unlock()
+	t.Cleanup(func() {
+		stateMutex.Lock()
+		state = saved
+		save()
+		stateMutex.Unlock()
+	})
+
+	now := time.Now()
+	j := &queuedJob{id: "u", tenant: "usage", enqueued: now.Add(-time.Minute), started: now}
+	recordDispatch(j, now)
+	recordRelease(j, true, now.Add(30*time.Second))
+	requeued := &queuedJob{id: "r", tenant: "usage", enqueued: now}
+	recordDispatch(requeued, now)
+	recordRelease(requeued, false, now)
+
+	stateMutex.Lock()
+	u := *state.Tenants["usage"]
+	stateMutex.Unlock()
+	want := tenantUsage{Dispatched: 2, Completed: 1, SlotSeconds: 30, WaitSeconds: 60}
+	if u != want {
+		t.Errorf("usage %+v, want %+v", u, want)
+	}
+}
@@ -0,0 +1,128 @@
+package rawcmp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"greengrader/webserver/gradescope"
+)
+
+// Tolerance controls how close two values must be to count as equal.
+// A value passes when |actual - expected| <= Abs + Rel*|expected|,
+// the same rule numpy.isclose uses.
+type Tolerance struct {
+	Abs float64
+	Rel float64
+}
+
+// Equal reports whether actual is within tolerance of expected.
+// Two NaNs compare equal so that a kernel can legitimately produce them.
+func (t Tolerance) Equal(expected, actual float64) bool {
+	if math.IsNaN(expected) || math.IsNaN(actual) {
+		return math.IsNaN(expected) && math.IsNaN(actual)
+	}
+	if expected == actual {
+		return true
+	}
+	return math.Abs(actual-expected) <= t.Abs+t.Rel*math.Abs(expected)
+}
+
+// Mismatch is one element that fell outside the tolerance.
+type Mismatch struct {
+	Index    int
+	Row      int
+	Col      int
+	Expected float64
+	Actual   float64
+}
+
+// Report is the outcome of comparing an expected and an actual matrix.
+type Report struct {
+	ExpectedRows, ExpectedCols int
+	ActualRows, ActualCols     int
+	Compared                   int
+	MismatchCount              int
+	// Mismatches holds at most the first MaxReport mismatches.
+	Mismatches []Mismatch
+}
+
+// ShapeMismatch reports whether the two matrices had different dimensions.
+func (r *Report) ShapeMismatch() bool {
+	return r.ExpectedRows != r.ActualRows || r.ExpectedCols != r.ActualCols
+}
+
+// Passed reports whether the shapes agree and every value is within tolerance.
+func (r *Report) Passed() bool {
+	return !r.ShapeMismatch() && r.MismatchCount == 0
+}
+
+// Compare checks actual against expected element by element. At most
+// maxReport mismatches are kept in the report, but all of them are counted.
+func Compare(expected, actual *Matrix, tol Tolerance, maxReport int) *Report {
+	r := &Report{
+		ExpectedRows: expected.Rows, ExpectedCols: expected.Cols,
+		ActualRows: actual.Rows, ActualCols: actual.Cols,
+	}
+	if r.ShapeMismatch() {
+		return r
+	}
+	for i, want := range expected.Data {
+		got := actual.Data[i]
+		r.Compared++
+		if tol.Equal(want, got) {
+			continue
+		}
+		r.MismatchCount++
+		if len(r.Mismatches) < maxReport {
+			r.Mismatches = append(r.Mismatches, Mismatch{
+				Index: i, Row: i / expected.Cols, Col: i % expected.Cols,
+				Expected: want, Actual: got,
+			})
+		}
+	}
+	return r
+}
+
+// String is a human readable summary suitable for a test's output field.
+func (r *Report) String() string {
+	var b strings.Builder
+	if r.ShapeMismatch() {
+		fmt.Fprintf(&b, "Shape mismatch: expected (%d, %d), got (%d, %d)\n",
+			r.ExpectedRows, r.ExpectedCols, r.ActualRows, r.ActualCols)
+		return b.String()
+	}
+	if r.MismatchCount == 0 {
+		fmt.Fprintf(&b, "All %d values match\n", r.Compared)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%d of %d values differ", r.MismatchCount, r.Compared)
+	if len(r.Mismatches) < r.MismatchCount {
+		fmt.Fprintf(&b, " (showing first %d)", len(r.Mismatches))
+	}
+	b.WriteString(":\n")
+	for _, m := range r.Mismatches {
+		fmt.Fprintf(&b, "  [%d, %d] expected %g, got %g\n", m.Row, m.Col, m.Expected, m.Actual)
+	}
+	return b.String()
+}
+
+// Test turns the report into a Gradescope test entry worth maxScore points.
+// The comparison is all or nothing.
+func (r *Report) Test(name string, maxScore float64) gradescope.Test {
+	t := gradescope.Test{
+		Name:     name,
+		MaxScore: maxScore,
+		Status:   gradescope.Failed,
+		Output:   r.String(),
+		ExtraData: map[string]any{
+			"compared":   r.Compared,
+			"mismatches": r.MismatchCount,
+		},
+	}
+	if r.Passed() {
+		t.Score = maxScore
+		t.Status = gradescope.Passed
+	}
+	return t
+}
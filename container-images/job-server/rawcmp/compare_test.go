@@ -0,0 +1,63 @@
+package rawcmp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestToleranceEqual(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		tol              Tolerance
+		expected, actual float64
+		want             bool
+	}{
+		{Tolerance{}, 1, 1, true},
+		{Tolerance{}, 1, 1.0000001, false},
+		{Tolerance{Abs: 1e-6}, 1, 1.0000001, true},
+		{Tolerance{Abs: 1e-6}, 1, 1.01, false},
+		{Tolerance{Rel: 0.01}, 100, 100.9, true},
+		{Tolerance{Rel: 0.01}, 100, 101.1, false},
+		{Tolerance{Rel: 0.01}, 0, 0.001, false},
+		{Tolerance{Abs: 1, Rel: 0.01}, 100, 101.9, true},
+		{Tolerance{}, nan, nan, true},
+		{Tolerance{Abs: 1}, nan, 0, false},
+		{Tolerance{Abs: 1}, 0, nan, false},
+		{Tolerance{}, math.Inf(1), math.Inf(1), true},
+	}
+	for _, tt := range tests {
+		if got := tt.tol.Equal(tt.expected, tt.actual); got != tt.want {
+			t.Errorf("%+v.Equal(%g, %g) = %v, want %v", tt.tol, tt.expected, tt.actual, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	expected := &Matrix{Rows: 2, Cols: 2, Data: []float64{1, 2, 3, 4}}
+	tests := []struct {
+		name       string
+		actual     *Matrix
+		passed     bool
+		shape      bool
+		mismatches int
+		kept       int
+	}{
+		{"equal", &Matrix{Rows: 2, Cols: 2, Data: []float64{1, 2, 3, 4}}, true, false, 0, 0},
+		{"one off", &Matrix{Rows: 2, Cols: 2, Data: []float64{1, 2, 3, 5}}, false, false, 1, 1},
+		{"all off", &Matrix{Rows: 2, Cols: 2, Data: []float64{0, 0, 0, 0}}, false, false, 4, 2},
+		{"transposed shape", &Matrix{Rows: 4, Cols: 1, Data: []float64{1, 2, 3, 4}}, false, true, 0, 0},
+	}
+	for _, tt := range tests {
+		r := Compare(expected, tt.actual, Tolerance{}, 2)
+		if r.Passed() != tt.passed || r.ShapeMismatch() != tt.shape ||
+			r.MismatchCount != tt.mismatches || len(r.Mismatches) != tt.kept {
+			t.Errorf("%s: passed=%v shape=%v mismatches=%d kept=%d, want %v %v %d %d", tt.name,
+				r.Passed(), r.ShapeMismatch(), r.MismatchCount, len(r.Mismatches),
+				tt.passed, tt.shape, tt.mismatches, tt.kept)
+		}
+	}
+	r := Compare(expected, &Matrix{Rows: 2, Cols: 2, Data: []float64{1, 2, 3, 5}}, Tolerance{}, 10)
+	if m := r.Mismatches[0]; m.Row != 1 || m.Col != 1 || m.Index != 3 {
+		t.Errorf("mismatch located at [%d, %d] index %d, want [1, 1] index 3", m.Row, m.Col, m.Index)
+	}
+}
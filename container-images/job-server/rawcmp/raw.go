@@ -0,0 +1,140 @@
+// Package rawcmp reads, writes and compares the .raw vector/matrix files used
+// by the OpenCL assignments (see Dataset/dataset_generator.py).
+//
+// A .raw file is a "# (rows, cols)" header followed by rows*cols
+// whitespace separated numbers in row-major order.
+package rawcmp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Matrix is the parsed contents of a .raw file. Vectors have Cols == 1.
+type Matrix struct {
+	Rows int
+	Cols int
+	Data []float64
+}
+
+// NewVector returns an N x 1 matrix holding values.
+func NewVector(values []float64) *Matrix {
+	return &Matrix{Rows: len(values), Cols: 1, Data: values}
+}
+
+// ReadFile parses the .raw file at path.
+func ReadFile(path string) (*Matrix, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Read parses a .raw file from r.
+func Read(r io.Reader) (*Matrix, error) {
+	br := bufio.NewReader(r)
+
+	header, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	rows, cols, err := parseHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	// The header comes from the student's program, so the slice grows with
+	// the values actually present instead of trusting the declared size.
+	m := &Matrix{Rows: rows, Cols: cols, Data: make([]float64, 0, min(rows*cols, maxPrealloc))}
+	sc := bufio.NewScanner(br)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	sc.Split(bufio.ScanWords)
+	for sc.Scan() {
+		v, err := strconv.ParseFloat(sc.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("value %d: %w", len(m.Data), err)
+		}
+		if len(m.Data) == rows*cols {
+			return nil, fmt.Errorf("header declares %dx%d = %d values, found more", rows, cols, rows*cols)
+		}
+		m.Data = append(m.Data, v)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.Data) != rows*cols {
+		return nil, fmt.Errorf("header declares %dx%d = %d values, found %d", rows, cols, rows*cols, len(m.Data))
+	}
+	return m, nil
+}
+
+// maxPrealloc bounds how many values Read allocates up front.
+const maxPrealloc = 1 << 16
+
+// maxDim bounds each dimension so rows*cols cannot overflow.
+const maxDim = 1 << 30
+
+// parseHeader accepts "# (rows, cols)" and "# (rows)". A zero dimension
+// counts as 1, as it does in helper_lib's LoadMatrix.
+func parseHeader(line string) (int, int, error) {
+	s := strings.TrimSpace(line)
+	if !strings.HasPrefix(s, "#") {
+		return 0, 0, fmt.Errorf("missing '# (rows, cols)' header")
+	}
+	s = strings.TrimSpace(strings.TrimPrefix(s, "#"))
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "("), ")")
+
+	parts := strings.Split(s, ",")
+	if len(parts) > 2 {
+		return 0, 0, fmt.Errorf("bad header %q", strings.TrimSpace(line))
+	}
+	dims := []int{1, 1}
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 || n > maxDim {
+			return 0, 0, fmt.Errorf("bad header %q", strings.TrimSpace(line))
+		}
+		if n > 0 {
+			dims[i] = n
+		}
+	}
+	return dims[0], dims[1], nil
+}
+
+// Write writes m in the same layout dataset_generator.py produces.
+func Write(w io.Writer, m *Matrix) error {
+	if len(m.Data) != m.Rows*m.Cols {
+		return fmt.Errorf("matrix is %dx%d but holds %d values", m.Rows, m.Cols, len(m.Data))
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# (%d, %d)\n", m.Rows, m.Cols)
+	for _, v := range m.Data {
+		bw.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		bw.WriteByte(' ')
+	}
+	return bw.Flush()
+}
+
+// WriteFile writes m to path.
+func WriteFile(path string, m *Matrix) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, m); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
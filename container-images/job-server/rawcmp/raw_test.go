@@ -0,0 +1,98 @@
+package rawcmp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		line       string
+		rows, cols int
+		wantErr    bool
+	}{
+		{"# (3, 2)\n", 3, 2, false},
+		{"#(3,2)", 3, 2, false},
+		{"# (5)", 5, 1, false},
+		{"# (5,)", 0, 0, true},
+		{"# (0, 4)", 1, 4, false},
+		{"# (4, 0)", 4, 1, false},
+		{"# (0, 0)", 1, 1, false},
+		{"(3, 2)", 0, 0, true},
+		{"# (3, 2, 1)", 0, 0, true},
+		{"# (-1, 2)", 0, 0, true},
+		{"# (x, 2)", 0, 0, true},
+		{"# (4294967296, 4294967296)", 0, 0, true},
+	}
+	for _, tt := range tests {
+		rows, cols, err := parseHeader(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseHeader(%q) error = %v, want error %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (rows != tt.rows || cols != tt.cols) {
+			t.Errorf("parseHeader(%q) = %d, %d, want %d, %d", tt.line, rows, cols, tt.rows, tt.cols)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []float64
+		wantErr string
+	}{
+		{"matrix", "# (2, 2)\n1 2\n3 4\n", []float64{1, 2, 3, 4}, ""},
+		{"vector", "# (3)\n1.5 -2 3e2", []float64{1.5, -2, 300}, ""},
+		{"zero dimension", "# (0, 0)\n7\n", []float64{7}, ""},
+		{"truncated", "# (2, 2)\n1 2 3", nil, "found 3"},
+		{"empty body", "# (2, 2)\n", nil, "found 0"},
+		{"too many values", "# (1, 2)\n1 2 3\n", nil, "found more"},
+		{"huge header", "# (1073741824, 1073741824)\n1 2\n", nil, "found 2"},
+		{"bad value", "# (2)\n1 x\n", nil, "value 1"},
+		{"no header", "1 2 3\n", nil, "header"},
+		{"empty file", "", nil, "header"},
+	}
+	for _, tt := range tests {
+		m, err := Read(strings.NewReader(tt.input))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if len(m.Data) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, m.Data, tt.want)
+			continue
+		}
+		for i := range tt.want {
+			if m.Data[i] != tt.want[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, m.Data, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	in := &Matrix{Rows: 2, Cols: 3, Data: []float64{1, 2.5, -3, 0, 1e-9, 42}}
+	var b strings.Builder
+	if err := Write(&b, in); err != nil {
+		t.Fatal(err)
+	}
+	out, err := Read(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := Compare(in, out, Tolerance{}, 10); !r.Passed() {
+		t.Errorf("round trip changed the matrix: %s", r)
+	}
+	if err := Write(&b, &Matrix{Rows: 2, Cols: 2, Data: []float64{1}}); err == nil {
+		t.Error("Write accepted a matrix whose data does not match its shape")
+	}
+}
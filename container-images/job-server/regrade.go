@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RegradeRequest selects the submissions of an assignment to grade again,
+// e.g. after a bug in the tests was fixed.
+type RegradeRequest struct {
+	Assignment string   `json:"assignment"`
+	Students   []string `json:"students,omitempty"`    // only submissions of these students (any group member)
+	LatestOnly bool     `json:"latest_only,omitempty"` // only each student's latest submission
+	// Image and BundleVersion override the assignment's runner image and
+	// pinned test bundle version for the regrade.
+	Image         string `json:"image,omitempty"`
+	BundleVersion int    `json:"bundle_version,omitempty"`
+}
+
+// regradeItem pairs an original submission with its regrade run.
+type regradeItem struct {
+	Original string   `json:"original"`
+	Regrade  string   `json:"regrade,omitempty"`
+	Students []string `json:"students"`
+	Before   *float64 `json:"before,omitempty"`
+	After    *float64 `json:"after,omitempty"`
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Regrade is a bulk regrade and, as its runs finish, its before/after report.
+type Regrade struct {
+	ID        string         `json:"id"`
+	Course    string         `json:"course"`
+	Request   RegradeRequest `json:"request"`
+	Requested string         `json:"requested_by"`
+	Created   time.Time      `json:"created"`
+	Total     int            `json:"total"`
+	Done      int            `json:"done"`
+	Changed   int            `json:"changed"` // finished runs whose score differs from the original
+	Items     []regradeItem  `json:"items"`
+}
+
+// regradesFile persists the regrades; their runs are in the job store.
+const regradesFile = "/app/regrades.json"
+
+var (
+	regrades      = map[string]*Regrade{}
+	regradesMutex sync.Mutex
+)
+
+func init() {
+	data, err := os.ReadFile(regradesFile)
+	if err != nil {
+		return
+	}
+	var list []*Regrade
+	if err := json.Unmarshal(data, &list); err != nil {
+		log.Printf("Ignoring unreadable %s: %v", regradesFile, err)
+		return
+	}
+	for _, rg := range list {
+		regrades[rg.ID] = rg
+	}
+}
+
+// saveRegrades writes regradesFile; regradesMutex must be held.
+func saveRegrades() error {
+	list := make([]*Regrade, 0, len(regrades))
+	for _, rg := range regrades {
+		list = append(list, rg)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(regradesFile), "regrades_tmp_*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	file.Close()
+	if err := os.Rename(file.Name(), regradesFile); err != nil { // atomic replace
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+// regradeSources returns the finished submissions a request selects, oldest
+// first, from the job store (and so from every job since the records were
+// first persisted). Submissions that never ran, and earlier regrade runs,
+// are skipped.
+func regradeSources(req RegradeRequest) []JobRecord {
+	jobStoreMutex.Lock()
+	var list []JobRecord
+	for _, rec := range jobStore {
+		if rec.Assignment != req.Assignment || rec.RegradeOf != "" || rec.Archive == "" ||
+			rec.FailureReason == failureInvalidArchive || rec.FailureReason == failurePrecheck {
+			continue
+		}
+		if rec.Status != statusSucceeded && rec.Status != statusFailed && rec.Status != statusCached {
+			continue
+		}
+		if len(req.Students) > 0 && !rec.sharesMember(req.Students) {
+			continue
+		}
+		list = append(list, *rec)
+	}
+	jobStoreMutex.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Submitted.Before(list[j].Submitted) })
+	if !req.LatestOnly {
+		return list
+	}
+	latest := map[string]int{} // student -> index in list
+	for i, rec := range list {
+		for _, s := range rec.members() {
+			latest[s] = i
+		}
+	}
+	var kept []JobRecord
+	for i, rec := range list {
+		for _, s := range rec.members() {
+			if latest[s] == i {
+				kept = append(kept, rec)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// errRegradeNotSaved is returned when a new regrade could not be persisted.
+var errRegradeNotSaved = errors.New("could not save the regrade")
+
+// startRegrade queues a bulk-priority run of every selected submission's
+// stored archive, with the overrides applied to a copy of the assignment.
+func startRegrade(req RegradeRequest, requestedBy string) (*Regrade, error) {
+	a := lookupAssignment(req.Assignment)
+	if a == defaultAssignment {
+		return nil, fmt.Errorf("unknown assignment %q", req.Assignment)
+	}
+	override := *a
+	if req.Image != "" {
+		override.Image = req.Image
+	}
+	if req.BundleVersion != 0 {
+		if a.TestBundle == nil {
+			return nil, fmt.Errorf("assignment %s has no test bundle", a.Name)
+		}
+		bundle := *a.TestBundle
+		bundle.Version = req.BundleVersion
+		override.TestBundle = &bundle
+	}
+
+	sources := regradeSources(req)
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no graded submissions match")
+	}
+	rg := &Regrade{
+		ID:        "rg-" + randomHex(4),
+		Course:    a.tenant(),
+		Request:   req,
+		Requested: requestedBy,
+		Created:   time.Now(),
+		Total:     len(sources),
+	}
+	// The runs are only queued once the regrade is saved, so a regrade whose
+	// report would be lost on a restart never starts.
+	var records []*JobRecord
+	var runs []*queuedJob
+	for _, orig := range sources {
+		item := regradeItem{Original: orig.ID, Students: orig.members(), Before: resultScore(orig.Results), Status: statusQueued}
+		if err := keepArchive(orig.Archive); err != nil {
+			item.Status, item.Error = statusFailed, err.Error()
+			rg.Items = append(rg.Items, item)
+			continue
+		}
+		now := time.Now()
+		id := newSubmissionID(a.Name, now)
+		records = append(records, &JobRecord{
+			ID:         id,
+			Student:    orig.Student,
+			Students:   orig.Students,
+			Assignment: orig.Assignment,
+			Priority:   priorityBulk,
+			Tenant:     orig.Tenant,
+			Status:     statusQueued,
+			Submitted:  now,
+			Archive:    orig.Archive,
+			Metadata:   orig.Metadata,
+			RegradeOf:  orig.ID,
+		})
+		runs = append(runs, &queuedJob{
+			id:         id,
+			assignment: &override,
+			archive:    orig.Archive,
+			priority:   priorityBulk,
+			tenant:     orig.Tenant,
+			enqueued:   now,
+		})
+		item.Regrade = id
+		rg.Items = append(rg.Items, item)
+	}
+	regradesMutex.Lock()
+	regrades[rg.ID] = rg
+	if err := saveRegrades(); err != nil {
+		delete(regrades, rg.ID)
+		regradesMutex.Unlock()
+		log.Printf("Saving %s: %v", regradesFile, err)
+		return nil, errRegradeNotSaved
+	}
+	regradesMutex.Unlock()
+	for i, rec := range records {
+		putJob(rec)
+		queue.push(runs[i])
+	}
+	log.Printf("Regrade %s of %s by %s: %d submissions", rg.ID, a.Name, requestedBy, rg.Total)
+	return rg, nil
+}
+
+// report returns a copy of the regrade with each item's status and new
+// score filled in from its run.
+func (rg *Regrade) report() Regrade {
+	out := *rg
+	out.Items = slices.Clone(rg.Items)
+	out.Done, out.Changed = 0, 0
+	for i := range out.Items {
+		item := &out.Items[i]
+		if item.Regrade != "" {
+			if rec, ok := getJob(item.Regrade); ok {
+				item.Status, item.Error = rec.Status, rec.Error
+				item.After = resultScore(rec.Results)
+			}
+		}
+		if item.Status == statusQueued || item.Status == statusPending {
+			continue
+		}
+		out.Done++
+		if item.After != nil && (item.Before == nil || *item.Before != *item.After) {
+			out.Changed++
+		}
+	}
+	return out
+}
+
+func formatScore(s *float64) string {
+	if s == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*s, 'f', -1, 64)
+}
+
+// regradesHandler serves /admin/regrades: POST starts a regrade from a
+// RegradeRequest, GET lists them, and GET /admin/regrades/{id} returns the
+// progress and before/after report (as CSV with ?format=csv). All need the
+// manage permission on the assignment's course.
+func regradesHandler(w http.ResponseWriter, r *http.Request) {
+	p := principalFrom(r)
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/regrades"), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		var req RegradeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !allowed(w, r, permManage, lookupAssignment(req.Assignment).tenant()) {
+			return
+		}
+		rg, err := startRegrade(req, p.Name)
+		if errors.Is(err, errRegradeNotSaved) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(rg.report())
+
+	case id == "" && r.Method == http.MethodGet:
+		regradesMutex.Lock()
+		list := []Regrade{}
+		for _, rg := range regrades {
+			if p.can(permManage, rg.Course) {
+				list = append(list, *rg)
+			}
+		}
+		regradesMutex.Unlock()
+		for i := range list {
+			list[i] = list[i].report()
+			list[i].Items = nil
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case id != "" && r.Method == http.MethodGet:
+		regradesMutex.Lock()
+		rg, ok := regrades[id]
+		regradesMutex.Unlock()
+		if !ok || !p.can(permManage, rg.Course) {
+			http.Error(w, "No such regrade", http.StatusNotFound)
+			return
+		}
+		report := rg.report()
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			out := csv.NewWriter(w)
+			out.Write([]string{"students", "original", "regrade", "before", "after", "status"})
+			for _, item := range report.Items {
+				out.Write([]string{strings.Join(item.Students, " "), item.Original, item.Regrade,
+					formatScore(item.Before), formatScore(item.After), item.Status})
+			}
+			out.Flush()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+
+	default:
+		http.Error(w, "Unsupported method or path", http.StatusMethodNotAllowed)
+	}
+}
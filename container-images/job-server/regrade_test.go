@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegradeSources(t *testing.T) {
+	withJobs(t)
+	base := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i, rec := range []*JobRecord{
+		{ID: "a1", Students: []string{"a", "b"}, Status: statusSucceeded},
+		{ID: "c1", Students: []string{"c"}, Status: statusFailed},
+		{ID: "a2", Students: []string{"a"}, Status: statusCached},
+		{ID: "a2-regrade", Students: []string{"a"}, Status: statusSucceeded, RegradeOf: "a2"},
+		{ID: "c2-rejected", Students: []string{"c"}, Status: statusFailed, FailureReason: failurePrecheck},
+		{ID: "c3-queued", Students: []string{"c"}, Status: statusQueued},
+		{ID: "d1-superseded", Students: []string{"d"}, Status: statusSuperseded},
+		{ID: "e1-no-archive", Students: []string{"e"}, Status: statusSucceeded, Archive: "-"},
+		{ID: "other-assignment", Students: []string{"a"}, Status: statusSucceeded, Assignment: "pa1"},
+	} {
+		rec.Student = rec.Students[0]
+		rec.Submitted = base.Add(time.Duration(i) * time.Hour)
+		if rec.Assignment == "" {
+			rec.Assignment = "pa2"
+		}
+		switch rec.Archive {
+		case "":
+			rec.Archive = "hash-" + rec.ID
+		case "-":
+			rec.Archive = ""
+		}
+		putJob(rec)
+	}
+	// Selection works from the persisted records, as after a restart. The
+	// restart fails the queued job, which makes it a source like any failure.
+	jobStoreMutex.Lock()
+	jobStore = map[string]*JobRecord{}
+	jobStoreMutex.Unlock()
+	loadJobs()
+
+	tests := []struct {
+		name string
+		req  RegradeRequest
+		want []string
+	}{
+		{"every graded submission", RegradeRequest{Assignment: "pa2"}, []string{"a1", "c1", "a2", "c3-queued"}},
+		{"by group member", RegradeRequest{Assignment: "pa2", Students: []string{"b"}}, []string{"a1"}},
+		{"latest only", RegradeRequest{Assignment: "pa2", LatestOnly: true}, []string{"a1", "a2", "c3-queued"}},
+		{"latest only for a", RegradeRequest{Assignment: "pa2", Students: []string{"a"}, LatestOnly: true}, []string{"a1", "a2"}},
+		{"nothing", RegradeRequest{Assignment: "pa3"}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, rec := range regradeSources(tt.req) {
+			got = append(got, rec.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// withRegrades gives the test a pa2 assignment and no regrades, and removes
+// the regrades file afterwards unless it was there before.
+func withRegrades(t *testing.T) {
+	t.Helper()
+	_, statErr := os.Stat(regradesFile)
+	configMutex.Lock()
+	savedAssignments := assignments
+	assignments = map[string]*Assignment{"pa2": {Name: "pa2", Image: "busybox", Command: []string{"true"}}}
+	configMutex.Unlock()
+	regradesMutex.Lock()
+	savedRegrades := regrades
+	regrades = map[string]*Regrade{}
+	regradesMutex.Unlock()
+	t.Cleanup(func() {
+		configMutex.Lock()
+		assignments = savedAssignments
+		configMutex.Unlock()
+		regradesMutex.Lock()
+		regrades = savedRegrades
+		regradesMutex.Unlock()
+		if os.IsNotExist(statErr) {
+			os.Remove(regradesFile)
+		}
+	})
+}
+
+func TestRegradeThatFailsToSaveQueuesNothing(t *testing.T) {
+	withJobs(t)
+	blockFile(t, regradesFile)
+	withRegrades(t)
+
+	putJob(&JobRecord{ID: "orig", Student: "a", Assignment: "pa2", Status: statusSucceeded, Archive: "missing"})
+	if _, err := startRegrade(RegradeRequest{Assignment: "pa2"}, "test"); !errors.Is(err, errRegradeNotSaved) {
+		t.Fatalf("error = %v, want %v", err, errRegradeNotSaved)
+	}
+	jobStoreMutex.Lock()
+	jobs := len(jobStore)
+	jobStoreMutex.Unlock()
+	if jobs != 1 || len(regrades) != 0 || queue.position("orig") != -1 {
+		t.Errorf("an unsaved regrade left %d jobs and %d regrades behind", jobs, len(regrades))
+	}
+}
+
+func TestRegradeQueuesArchiveHashes(t *testing.T) {
+	if _, err := os.Stat(filepath.Dir(archiveDir)); err != nil {
+		t.Skipf("%s is not available", filepath.Dir(archiveDir))
+	}
+	withJobs(t)
+	withRegrades(t)
+	_, dirErr := os.Stat(archiveDir)
+	hash, err := storeArchive(testZip(t, zipEntry{name: "main.c", contents: t.Name()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Remove(archivePath(hash))
+		os.Remove(filepath.Dir(archivePath(hash)))
+		if os.IsNotExist(dirErr) {
+			os.Remove(archiveDir)
+		}
+	})
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(archivePath(hash), old, old)
+
+	putJob(&JobRecord{ID: "stored", Student: "a", Assignment: "pa2", Status: statusSucceeded, Archive: hash, Submitted: old})
+	putJob(&JobRecord{ID: "swept", Student: "b", Assignment: "pa2", Status: statusSucceeded, Archive: strings.Repeat("0", 64), Submitted: old.Add(time.Minute)})
+	rg, err := startRegrade(RegradeRequest{Assignment: "pa2"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.mu.Lock()
+	waiting := queue.waiting
+	queue.mu.Unlock()
+	if len(waiting) != 1 || waiting[0].archive != hash {
+		t.Fatalf("queued %+v, want one run of the stored archive", waiting)
+	}
+	if len(rg.Items) != 2 || rg.Items[0].Status != statusQueued || rg.Items[1].Status != statusFailed {
+		t.Errorf("regrade items %+v, want the swept archive failed", rg.Items)
+	}
+	// The archive's retention restarts so the sweep keeps it until dispatch.
+	if info, err := os.Stat(archivePath(hash)); err != nil || !info.ModTime().After(old) {
+		t.Errorf("the queued archive's retention was not restarted: %v", err)
+	}
+}
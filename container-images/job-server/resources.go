@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ResourceConfig sets the runner container's requests and limits. Values use
+// Kubernetes quantity syntax ("500m", "256Mi"); empty fields are left unset.
+type ResourceConfig struct {
+	CPURequest            string `json:"cpu_request,omitempty"`
+	CPULimit              string `json:"cpu_limit,omitempty"`
+	MemoryRequest         string `json:"memory_request,omitempty"`
+	MemoryLimit           string `json:"memory_limit,omitempty"`
+	EphemeralStorageLimit string `json:"ephemeral_storage_limit,omitempty"`
+
+	// Extended resources such as "greengrader.ucsd.edu/opencl". Kubernetes
+	// requires requests to equal limits for these, so one value sets both.
+	Extended map[string]string `json:"extended,omitempty"`
+}
+
+// requirements converts the config into the container's ResourceRequirements.
+func (c *ResourceConfig) requirements() (corev1.ResourceRequirements, error) {
+	req := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{},
+		Limits:   corev1.ResourceList{},
+	}
+	if c == nil {
+		return req, nil
+	}
+	set := func(list corev1.ResourceList, name corev1.ResourceName, value string) error {
+		if value == "" {
+			return nil
+		}
+		q, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("resource %s: %v", name, err)
+		}
+		list[name] = q
+		return nil
+	}
+	for _, s := range []struct {
+		list  corev1.ResourceList
+		name  corev1.ResourceName
+		value string
+	}{
+		{req.Requests, corev1.ResourceCPU, c.CPURequest},
+		{req.Limits, corev1.ResourceCPU, c.CPULimit},
+		{req.Requests, corev1.ResourceMemory, c.MemoryRequest},
+		{req.Limits, corev1.ResourceMemory, c.MemoryLimit},
+		{req.Limits, corev1.ResourceEphemeralStorage, c.EphemeralStorageLimit},
+	} {
+		if err := set(s.list, s.name, s.value); err != nil {
+			return req, err
+		}
+	}
+	for name, value := range c.Extended {
+		if err := set(req.Requests, corev1.ResourceName(name), value); err != nil {
+			return req, err
+		}
+		if err := set(req.Limits, corev1.ResourceName(name), value); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// Failure reasons recorded on a job when Kubernetes, not the grader, ended it,
+// or when the server refused to run it.
+const (
+	failureOOMKilled      = "oom_killed"
+	failureEvicted        = "evicted"
+	failureInvalidArchive = "invalid_archive"
+	failurePrecheck       = "precheck_failed"
+)
+
+// podFailureReason inspects a finished runner pod for OOM kills and evictions.
+func podFailureReason(pod *corev1.Pod) string {
+	if pod.Status.Reason == "Evicted" {
+		return failureEvicted
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; t != nil && t.Reason == "OOMKilled" {
+			return failureOOMKilled
+		}
+		if t := cs.LastTerminationState.Terminated; t != nil && t.Reason == "OOMKilled" {
+			return failureOOMKilled
+		}
+	}
+	return ""
+}
+
+// failureMessage is the student facing explanation for a failure reason.
+func failureMessage(reason string, a *Assignment) string {
+	switch reason {
+	case failureOOMKilled:
+		msg := "Your submission was killed because it ran out of memory"
+		if a.Resources != nil && a.Resources.MemoryLimit != "" {
+			msg += " (limit " + a.Resources.MemoryLimit + ")"
+		}
+		return msg + "."
+	case failureEvicted:
+		return "The grading pod was evicted from its node before it finished. Please resubmit."
+	}
+	return ""
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// resultCacheFile persists the results of graded archives (Assignment.CacheResults).
+const resultCacheFile = "/app/result_cache.json"
+
+// cachedResult is a run's results.json before scoring, so late penalties
+// and other per-submission scoring still apply to every cache hit.
+type cachedResult struct {
+	Results     json.RawMessage `json:"results"`
+	JobID       string          `json:"job_id"`
+	ImageDigest string          `json:"image_digest"`
+	Created     time.Time       `json:"created"`
+}
+
+var (
+	resultCache      = map[string]*cachedResult{}
+	resultCacheMutex sync.Mutex
+)
+
+func init() {
+	data, err := os.ReadFile(resultCacheFile)
+	if err != nil {
+		return
+	}
+	var st struct {
+		Results map[string]*cachedResult `json:"results"`
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		log.Printf("Ignoring unreadable %s: %v", resultCacheFile, err)
+		return
+	}
+	if st.Results != nil {
+		resultCache = st.Results
+	}
+}
+
+// saveResultCache writes resultCacheFile; resultCacheMutex must be held.
+func saveResultCache() error {
+	data, err := json.Marshal(map[string]any{"results": resultCache})
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(resultCacheFile), "result_cache_tmp_*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	file.Close()
+	if err := os.Rename(file.Name(), resultCacheFile); err != nil { // atomic replace
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+// resultCacheKey identifies everything a deterministic run depends on: the
+// archive, the exact runner image, the test bundle and dataset it was given
+// and the assignment configuration.
+func resultCacheKey(a *Assignment, archive, imageDigest string, bundleVersion int, datasetSeed *int64) string {
+	fields := []string{a.Name, strconv.Itoa(a.Version), archive, imageDigest, strconv.Itoa(bundleVersion)}
+	if datasetSeed != nil {
+		fields = append(fields, strconv.FormatInt(*datasetSeed, 10))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachesResults reports whether the assignment's results may be reused.
+// Benchmarks measure the run itself, so they never are, and an image that is
+// not pinned by digest may change under the same reference.
+func (a *Assignment) cachesResults() bool {
+	return a.CacheResults && a.Benchmark == nil && pinnedDigest(a.Image) != ""
+}
+
+// pinnedDigest returns the digest of an image reference pinned with
+// "@sha256:...", or "".
+func pinnedDigest(image string) string {
+	if _, digest, ok := strings.Cut(image, "@"); ok && strings.HasPrefix(digest, "sha256:") {
+		return digest
+	}
+	return ""
+}
+
+// podImageDigest returns the digest of the image the runner container ran.
+func podImageDigest(pod *corev1.Pod) string {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == "runner" {
+			if _, digest, ok := strings.Cut(cs.ImageID, "@"); ok {
+				return digest
+			}
+		}
+	}
+	return ""
+}
+
+// lookupCachedResult finds the results of an earlier run that the new
+// submission would reproduce. It needs the assignment's current bundle
+// version, so it may call the API server.
+func lookupCachedResult(clientset kubernetes.Interface, a *Assignment, rec *JobRecord) (*cachedResult, error) {
+	digest := pinnedDigest(a.Image)
+	if !a.cachesResults() || rec.Archive == "" {
+		return nil, nil
+	}
+	bundleVersion := 0
+	if a.TestBundle != nil {
+		v, err := currentBundleVersion(clientset, a.TestBundle)
+		if err != nil {
+			return nil, err
+		}
+		bundleVersion = v
+	}
+	var seed *int64
+	if a.Dataset != nil {
+		s := datasetSeed(rec.Student, rec.Assignment)
+		seed = &s
+	}
+	resultCacheMutex.Lock()
+	defer resultCacheMutex.Unlock()
+	hit := resultCache[resultCacheKey(a, rec.Archive, digest, bundleVersion, seed)]
+	if hit == nil {
+		return nil, nil
+	}
+	copied := *hit
+	return &copied, nil
+}
+
+// storeCachedResult remembers the unscored results of a successful run.
+func storeCachedResult(a *Assignment, rec JobRecord, results []byte) {
+	if !a.cachesResults() || rec.Archive == "" {
+		return
+	}
+	digest := pinnedDigest(a.Image)
+	resultCacheMutex.Lock()
+	defer resultCacheMutex.Unlock()
+	key := resultCacheKey(a, rec.Archive, digest, rec.TestBundleVersion, rec.DatasetSeed)
+	resultCache[key] = &cachedResult{Results: results, JobID: rec.ID, ImageDigest: digest, Created: time.Now()}
+	if err := saveResultCache(); err != nil {
+		log.Printf("Saving %s: %v", resultCacheFile, err)
+	}
+}
+
+// serveCachedResult completes a submission from the cache without running it.
+func serveCachedResult(a *Assignment, rec *JobRecord, hit *cachedResult) error {
+	results, err := applyScoring(a.Scoring, hit.Results, rec.Submitted, rec.Metadata)
+	if err != nil {
+		return fmt.Errorf("scoring cached results: %v", err)
+	}
+	rec.Status = statusCached
+	rec.Results = attachWarnings(results, rec.Warnings)
+	rec.CachedFrom = hit.JobID
+	rec.ImageDigest = hit.ImageDigest
+	rec.Finished = time.Now()
+	rec.Latency = rec.Finished.Sub(rec.Submitted)
+	return nil
+}
+
+// pruneResultCache drops entries older than ARCHIVE_RETENTION, whose
+// archives may be gone.
+func pruneResultCache() {
+	retention := archiveRetention()
+	if retention == 0 {
+		return
+	}
+	cutoff := time.Now().Add(-retention)
+	resultCacheMutex.Lock()
+	defer resultCacheMutex.Unlock()
+	pruned := 0
+	for key, c := range resultCache {
+		if c.Created.Before(cutoff) {
+			delete(resultCache, key)
+			pruned++
+		}
+	}
+	if pruned > 0 {
+		if err := saveResultCache(); err != nil {
+			log.Printf("Saving %s: %v", resultCacheFile, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// withResultCache gives the test an empty result cache and removes the cache
+// file afterwards unless it was there before.
+func withResultCache(t *testing.T) {
+	t.Helper()
+	_, statErr := os.Stat(resultCacheFile)
+	resultCacheMutex.Lock()
+	saved := resultCache
+	resultCache = map[string]*cachedResult{}
+	resultCacheMutex.Unlock()
+	t.Cleanup(func() {
+		resultCacheMutex.Lock()
+		resultCache = saved
+		resultCacheMutex.Unlock()
+		if os.IsNotExist(statErr) {
+			os.Remove(resultCacheFile)
+		}
+	})
+}
+
+func TestPinnedDigest(t *testing.T) {
+	tests := []struct {
+		image, want string
+	}{
+		{"ghcr.io/course/pa1@" + testDigest, testDigest},
+		{"ghcr.io/course/pa1:v2@" + testDigest, testDigest},
+		{"ghcr.io/course/pa1:latest", ""},
+		{"localhost:5000/pa1", ""},
+		{"pa1@md5:abc", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := pinnedDigest(tt.image); got != tt.want {
+			t.Errorf("pinnedDigest(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestCachesResults(t *testing.T) {
+	pinned := "ghcr.io/course/pa1@" + testDigest
+	tests := []struct {
+		name       string
+		a          Assignment
+		caches     bool
+		validateOK bool
+	}{
+		{"pinned", Assignment{Name: "pa1", Image: pinned, CacheResults: true}, true, true},
+		{"tag", Assignment{Name: "pa1", Image: "ghcr.io/course/pa1:latest", CacheResults: true}, false, false},
+		{"off", Assignment{Name: "pa1", Image: "ghcr.io/course/pa1:latest"}, false, true},
+		{"benchmark", Assignment{Name: "pa1", Image: pinned, CacheResults: true, Benchmark: &BenchmarkConfig{TimedCommand: "true"}}, false, false},
+	}
+	for _, tt := range tests {
+		a := tt.a
+		a.Command = []string{"true"}
+		if got := a.cachesResults(); got != tt.caches {
+			t.Errorf("%s: cachesResults = %v, want %v", tt.name, got, tt.caches)
+		}
+		configMutex.RLock()
+		err := a.validate()
+		configMutex.RUnlock()
+		if (err == nil) != tt.validateOK {
+			t.Errorf("%s: validate = %v, want ok %v", tt.name, err, tt.validateOK)
+		}
+	}
+}
+
+func TestResultCacheRoundTrip(t *testing.T) {
+	withResultCache(t)
+	a := &Assignment{Name: "pa1", Image: "ghcr.io/course/pa1@" + testDigest, CacheResults: true, ConfigMeta: ConfigMeta{Version: 3}}
+	graded := JobRecord{ID: "first", Student: "s1", Assignment: "pa1", Archive: "abc"}
+	storeCachedResult(a, graded, []byte(`{"score": 8}`))
+
+	again := &JobRecord{ID: "second", Student: "s2", Assignment: "pa1", Archive: "abc", Submitted: time.Now()}
+	hit, err := lookupCachedResult(nil, a, again)
+	if err != nil || hit == nil || hit.JobID != "first" || hit.ImageDigest != testDigest {
+		t.Fatalf("lookup = %+v, %v; want the first job's results", hit, err)
+	}
+	if err := serveCachedResult(a, again, hit); err != nil {
+		t.Fatal(err)
+	}
+	if again.Status != statusCached || again.CachedFrom != "first" || string(again.Results) != `{"score": 8}` {
+		t.Errorf("served %+v", again)
+	}
+
+	misses := []struct {
+		name string
+		a    *Assignment
+		rec  *JobRecord
+	}{
+		{"other archive", a, &JobRecord{Assignment: "pa1", Archive: "def"}},
+		{"new config version", &Assignment{Name: "pa1", Image: a.Image, CacheResults: true, ConfigMeta: ConfigMeta{Version: 4}}, again},
+		{"other image", &Assignment{Name: "pa1", Image: "ghcr.io/course/pa1@sha256:ff", CacheResults: true, ConfigMeta: ConfigMeta{Version: 3}}, again},
+		{"image no longer pinned", &Assignment{Name: "pa1", Image: "ghcr.io/course/pa1:latest", CacheResults: true, ConfigMeta: ConfigMeta{Version: 3}}, again},
+	}
+	for _, m := range misses {
+		if hit, err := lookupCachedResult(nil, m.a, m.rec); hit != nil || err != nil {
+			t.Errorf("%s: hit %+v, %v", m.name, hit, err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"greengrader/webserver/gradescope"
+)
+
+// Result formats a runner can print on stdout.
+const (
+	formatAuto       = ""
+	formatGradescope = "gradescope"
+	formatJUnit      = "junit"
+	formatTAP        = "tap"
+)
+
+// detectResultFormat guesses the format of a runner's output.
+func detectResultFormat(out []byte) string {
+	trimmed := bytes.TrimSpace(out)
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed):
+		return formatGradescope
+	case gradescope.LooksLikeJUnit(out):
+		return formatJUnit
+	case gradescope.LooksLikeTAP(out):
+		return formatTAP
+	}
+	return formatGradescope
+}
+
+// testPoints returns how much a test named name is worth for a.
+func (a *Assignment) testPoints(name string) float64 {
+	if p, ok := a.TestPoints[name]; ok {
+		return p
+	}
+	if a.DefaultTestPoints != 0 {
+		return a.DefaultTestPoints
+	}
+	return 1
+}
+
+// convertResults turns the runner's output into a Gradescope results.json.
+// Gradescope JSON is passed through untouched; JUnit and TAP reports are
+// converted and weighted with the assignment's test points. Skipped and TODO
+// tests, which the parsers leave without a status, are worth nothing.
+func convertResults(a *Assignment, out []byte) ([]byte, error) {
+	format := a.ResultFormat
+	if format == formatAuto {
+		format = detectResultFormat(out)
+	}
+
+	var tests []gradescope.Test
+	var err error
+	switch format {
+	case formatGradescope:
+		if !json.Valid(bytes.TrimSpace(out)) {
+			return nil, fmt.Errorf("output is not valid results.json")
+		}
+		return out, nil
+	case formatJUnit:
+		tests, err = gradescope.ParseJUnit(out)
+	case formatTAP:
+		tests, err = gradescope.ParseTAP(out)
+	default:
+		return nil, fmt.Errorf("unknown result format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tests {
+		t := &tests[i]
+		if t.Status == "" {
+			continue
+		}
+		t.MaxScore = a.testPoints(t.Name)
+		if t.Status == gradescope.Passed {
+			t.Score = t.MaxScore
+		}
+	}
+	return json.Marshal(gradescope.Results{Tests: tests})
+}
+
+// errorResults is the results.json reported when the runner's output could not be used.
+func errorResults(msg string, out []byte) []byte {
+	zero := 0.0
+	res := gradescope.Results{Score: &zero, Output: msg}
+	if len(out) > 0 {
+		res.Output += "\n\nRunner output:\n" + string(out)
+	}
+	data, _ := json.Marshal(res)
+	return data
+}
+
+// rawResults is a results.json decoded into gradescope.Results together with
+// the keys the struct does not model, such as the n_time the PA2 Makefile
+// prints, so rewriting the results keeps them.
+type rawResults struct {
+	gradescope.Results
+	fields map[string]json.RawMessage   // unmodelled top-level keys
+	tests  []map[string]json.RawMessage // unmodelled keys of each test
+}
+
+func parseRawResults(data []byte) (*rawResults, error) {
+	r := &rawResults{}
+	if err := json.Unmarshal(data, &r.Results); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &r.fields); err != nil {
+		return nil, err
+	}
+	if tests, ok := r.fields["tests"]; ok {
+		if err := json.Unmarshal(tests, &r.tests); err != nil {
+			return nil, err
+		}
+	}
+	dropModelled(r.fields, r.Results)
+	for i := range r.tests {
+		if i < len(r.Tests) {
+			dropModelled(r.tests[i], r.Tests[i])
+		}
+	}
+	return r, nil
+}
+
+// dropModelled deletes from fields the keys that v writes when marshalled.
+func dropModelled(fields map[string]json.RawMessage, v any) {
+	data, _ := json.Marshal(v)
+	var modelled map[string]json.RawMessage
+	json.Unmarshal(data, &modelled)
+	for k := range modelled {
+		delete(fields, k)
+	}
+}
+
+// mergeFields marshals v and adds its keys to fields.
+func mergeFields(fields map[string]json.RawMessage, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &fields)
+}
+
+// marshal writes the results with the unmodelled keys put back.
+func (r *rawResults) marshal() ([]byte, error) {
+	out := map[string]json.RawMessage{}
+	for k, v := range r.fields {
+		out[k] = v
+	}
+	if err := mergeFields(out, r.Results); err != nil {
+		return nil, err
+	}
+	if len(r.Tests) > 0 {
+		tests := make([]map[string]json.RawMessage, len(r.Tests))
+		for i := range r.Tests {
+			tests[i] = map[string]json.RawMessage{}
+			if i < len(r.tests) {
+				for k, v := range r.tests[i] {
+					tests[i][k] = v
+				}
+			}
+			if err := mergeFields(tests[i], r.Tests[i]); err != nil {
+				return nil, err
+			}
+		}
+		data, err := json.Marshal(tests)
+		if err != nil {
+			return nil, err
+		}
+		out["tests"] = data
+	}
+	return json.Marshal(out)
+}
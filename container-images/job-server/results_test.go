@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"greengrader/webserver/gradescope"
+)
+
+func TestConvertResults(t *testing.T) {
+	a := &Assignment{Name: "t", TestPoints: map[string]float64{"big": 5}, DefaultTestPoints: 2}
+	tests := []struct {
+		name       string
+		format     string
+		out        string
+		score, max float64
+	}{
+		{"tap", formatAuto, "1..3\nok 1 - big\nnot ok 2 - small\nok 3 - gpu # SKIP\n", 5, 7},
+		{"tap todo", formatTAP, "1..2\nnot ok 1 - big # TODO\nok 2 - small\n", 2, 2},
+		{"junit", formatAuto, `<testsuite><testcase name="big"/><testcase name="x"><skipped/></testcase><testcase name="y"><failure/></testcase></testsuite>`, 5, 7},
+		{"gradescope", formatAuto, `{"tests":[{"name":"a","score":1,"max_score":3}]}`, 1, 3},
+	}
+	for _, tt := range tests {
+		a.ResultFormat = tt.format
+		data, err := convertResults(a, []byte(tt.out))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var res gradescope.Results
+		if err := json.Unmarshal(data, &res); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if res.TotalScore() != tt.score || res.MaxScore() != tt.max {
+			t.Errorf("%s: scored %g/%g, want %g/%g", tt.name, res.TotalScore(), res.MaxScore(), tt.score, tt.max)
+		}
+	}
+	if _, err := convertResults(&Assignment{ResultFormat: formatGradescope}, []byte("not json")); err == nil {
+		t.Error("invalid Gradescope JSON was accepted")
+	}
+}
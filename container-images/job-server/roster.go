@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"greengrader/webserver/gradescope"
+)
+
+// rostersFile persists every course's roster.
+const rostersFile = "/app/rosters.json"
+
+// What happens to submitters that are not on a course's roster (Tenant.UnknownSubmitters).
+const (
+	unknownAccept = "accept" // grade them under their sanitized name (default)
+	unknownFlag   = "flag"   // grade them, but mark the job record
+	unknownReject = "reject" // refuse the submission
+)
+
+// RosterEntry is one student of a course. ID is assigned by the server and
+// stays the same across re-imports, so job records refer to it rather than
+// to a display name.
+type RosterEntry struct {
+	ID        string `json:"id"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Email     string `json:"email,omitempty"`
+	SID       string `json:"sid,omitempty"`
+}
+
+var (
+	rosters      = map[string][]*RosterEntry{} // course -> students
+	rostersMutex sync.Mutex
+)
+
+func init() {
+	data, err := os.ReadFile(rostersFile)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &rosters); err != nil {
+		log.Printf("Ignoring unreadable %s: %v", rostersFile, err)
+	}
+}
+
+// saveRosters writes rostersFile; rostersMutex must be held.
+func saveRosters() error {
+	data, err := json.MarshalIndent(rosters, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(rostersFile), "rosters_tmp_*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	file.Close()
+	if err := os.Rename(file.Name(), rostersFile); err != nil { // atomic replace
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+func (t *Tenant) unknownSubmitters() string {
+	if t.UnknownSubmitters == "" {
+		return unknownAccept
+	}
+	return t.UnknownSubmitters
+}
+
+// matches reports whether the entry is the given user, by email or SID.
+func (e *RosterEntry) matches(email, sid string) bool {
+	return email != "" && strings.EqualFold(e.Email, email) || sid != "" && e.SID == sid
+}
+
+// findRosterEntry looks a submitter up in the course roster; rostersMutex must be held.
+func findRosterEntry(course, email, sid string) *RosterEntry {
+	for _, e := range rosters[course] {
+		if e.matches(email, sid) {
+			return e
+		}
+	}
+	return nil
+}
+
+// resolveSubmitter returns the name a submission is recorded under: the
+// roster ID when the Gradescope submitter is on the course roster, otherwise
+// the sanitized display name, flagged or rejected as the course's policy says.
+func resolveSubmitter(course string, user *gradescope.User, displayName string) (student, flag string, err error) {
+	if user != nil {
+		rostersMutex.Lock()
+		e := findRosterEntry(course, strings.TrimSpace(user.Email), strings.TrimSpace(user.SID))
+		rostersMutex.Unlock()
+		if e != nil {
+			return e.ID, "", nil
+		}
+		if displayName == "" {
+			displayName = user.Name
+		}
+	}
+	student = sanitizeK8sName(displayName)
+	switch lookupTenant(course).unknownSubmitters() {
+	case unknownReject:
+		if user == nil {
+			return "", "", fmt.Errorf("course %s requires submission_metadata.json to identify the submitter", course)
+		}
+		return "", "", fmt.Errorf("%s is not on the roster of %s", user.Email, course)
+	case unknownFlag:
+		if user == nil {
+			return student, "no submission metadata", nil
+		}
+		return student, "not on roster", nil
+	}
+	return student, "", nil
+}
+
+// resolveSubmitters resolves every member of a (group) submission with
+// resolveSubmitter. The first user is the primary submitter; the list has no
+// duplicates. One rejected member rejects the whole submission.
+func resolveSubmitters(course string, users []gradescope.User, displayName string) (students []string, flag string, err error) {
+	if len(users) == 0 {
+		student, flag, err := resolveSubmitter(course, nil, displayName)
+		if err != nil || student == "" {
+			return nil, flag, err
+		}
+		return []string{student}, flag, nil
+	}
+	for i := range users {
+		name := ""
+		if i == 0 {
+			name = displayName
+		}
+		student, memberFlag, err := resolveSubmitter(course, &users[i], name)
+		if err != nil {
+			return nil, "", err
+		}
+		if student == "" || slices.Contains(students, student) {
+			continue
+		}
+		students = append(students, student)
+		if flag == "" && memberFlag != "" {
+			flag = memberFlag
+			if len(users) > 1 {
+				flag += ": " + users[i].Email
+			}
+		}
+	}
+	return students, flag, nil
+}
+
+// runnerMetadata is the submission_metadata.json mounted into the runner.
+// The pod and its ConfigMap live in the course namespace, so every user's
+// name, email, SID and Gradescope ID are replaced with their roster ID, or
+// "unlisted-<n>" for users not on the roster; only the job store links a
+// submission to the people behind it.
+func runnerMetadata(course string, md *gradescope.SubmissionMetadata) ([]byte, error) {
+	copied := *md
+	copied.Users = make([]gradescope.User, len(md.Users))
+	rostersMutex.Lock()
+	for i, u := range md.Users {
+		name := fmt.Sprintf("unlisted-%d", i+1)
+		if e := findRosterEntry(course, strings.TrimSpace(u.Email), strings.TrimSpace(u.SID)); e != nil {
+			name = e.ID
+		}
+		copied.Users[i] = gradescope.User{Name: name}
+	}
+	rostersMutex.Unlock()
+	return json.Marshal(copied)
+}
+
+// errRosterNotSaved is returned when an import could not be persisted; the
+// previous roster is kept.
+var errRosterNotSaved = errors.New("could not save the roster")
+
+// importRoster merges entries into the course roster, keeping the IDs of
+// students already on it (matched by email or SID). With replace, students
+// missing from entries are dropped.
+func importRoster(course string, entries []RosterEntry, replace bool) (added, updated, removed int, err error) {
+	for i, e := range entries {
+		if strings.TrimSpace(e.Email) == "" && strings.TrimSpace(e.SID) == "" {
+			return 0, 0, 0, fmt.Errorf("entry %d has neither an email nor a SID", i+1)
+		}
+	}
+
+	rostersMutex.Lock()
+	defer rostersMutex.Unlock()
+	current, hadRoster := rosters[course]
+	var saved []RosterEntry // entries are updated in place
+	for _, e := range current {
+		saved = append(saved, *e)
+	}
+	seen := map[*RosterEntry]bool{}
+	for _, in := range entries {
+		in.Email, in.SID = strings.TrimSpace(in.Email), strings.TrimSpace(in.SID)
+		if e := findRosterEntry(course, in.Email, in.SID); e != nil {
+			in.ID = e.ID
+			*e = in
+			seen[e] = true
+			updated++
+			continue
+		}
+		e := in
+		e.ID = "r" + randomHex(4)
+		rosters[course] = append(rosters[course], &e)
+		seen[&e] = true
+		added++
+	}
+	if replace {
+		kept := rosters[course][:0]
+		for _, e := range rosters[course] {
+			if seen[e] {
+				kept = append(kept, e)
+			} else {
+				removed++
+			}
+		}
+		rosters[course] = kept
+	}
+	if err := saveRosters(); err != nil {
+		log.Printf("Saving %s: %v", rostersFile, err)
+		restored := make([]*RosterEntry, len(saved))
+		for i := range saved {
+			restored[i] = &saved[i]
+		}
+		rosters[course] = restored
+		if !hadRoster {
+			delete(rosters, course)
+		}
+		return 0, 0, 0, errRosterNotSaved
+	}
+	return added, updated, removed, nil
+}
+
+// parseRosterCSV reads a roster with a header row. The columns first_name,
+// last_name, email and sid are recognised (as written by
+// scripts/roster_generator.py); others are ignored.
+func parseRosterCSV(r io.Reader) ([]RosterEntry, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parsing roster CSV: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("roster CSV is empty")
+	}
+	col := map[string]int{}
+	for i, h := range rows[0] {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	_, hasEmail := col["email"]
+	_, hasSID := col["sid"]
+	if !hasEmail && !hasSID {
+		return nil, fmt.Errorf("roster CSV needs an email or sid column")
+	}
+	get := func(row []string, name string) string {
+		if i, ok := col[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	var entries []RosterEntry
+	for _, row := range rows[1:] {
+		entries = append(entries, RosterEntry{
+			FirstName: get(row, "first_name"),
+			LastName:  get(row, "last_name"),
+			Email:     get(row, "email"),
+			SID:       get(row, "sid"),
+		})
+	}
+	return entries, nil
+}
+
+// rostersHandler serves /admin/rosters/{course}. GET returns the roster to
+// course staff. POST imports a CSV (as the body with Content-Type text/csv,
+// or as the multipart field "roster") or a JSON array of entries, merging
+// into the roster; with ?replace=true students not in the upload are removed.
+func rostersHandler(w http.ResponseWriter, r *http.Request) {
+	course := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/rosters/"), "/")
+	if course == "" {
+		http.Error(w, "Missing course in URL path, e.g., /admin/rosters/cse160", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !allowed(w, r, permViewJobs, course) {
+			return
+		}
+		rostersMutex.Lock()
+		list := []RosterEntry{}
+		for _, e := range rosters[course] {
+			list = append(list, *e)
+		}
+		rostersMutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case http.MethodPost:
+		if !allowed(w, r, permManage, course) {
+			return
+		}
+		var entries []RosterEntry
+		var err error
+		contentType := r.Header.Get("Content-Type")
+		switch {
+		case strings.HasPrefix(contentType, "application/json"):
+			err = json.NewDecoder(r.Body).Decode(&entries)
+		case strings.HasPrefix(contentType, "multipart/form-data"):
+			file, _, ferr := r.FormFile("roster")
+			if ferr != nil {
+				http.Error(w, "Missing 'roster' file", http.StatusBadRequest)
+				return
+			}
+			defer file.Close()
+			entries, err = parseRosterCSV(file)
+		default:
+			entries, err = parseRosterCSV(r.Body)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		added, updated, removed, err := importRoster(course, entries, r.URL.Query().Get("replace") == "true")
+		if errors.Is(err, errRosterNotSaved) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"added": added, "updated": updated, "removed": removed})
+
+	default:
+		http.Error(w, "Only GET and POST methods allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"greengrader/webserver/gradescope"
+)
+
+// withRosters replaces the rosters for the duration of a test and removes
+// the rosters file afterwards unless it was there before.
+func withRosters(t *testing.T, table map[string][]*RosterEntry) {
+	t.Helper()
+	_, statErr := os.Stat(rostersFile)
+	rostersMutex.Lock()
+	saved := rosters
+	rosters = table
+	rostersMutex.Unlock()
+	t.Cleanup(func() {
+		rostersMutex.Lock()
+		rosters = saved
+		rostersMutex.Unlock()
+		if os.IsNotExist(statErr) {
+			os.Remove(rostersFile)
+		}
+	})
+}
+
+func TestRosterImportThatFailsToSave(t *testing.T) {
+	blockFile(t, rostersFile)
+	ada := RosterEntry{ID: "r1", FirstName: "Ada", Email: "ada@ucsd.edu"}
+	withRosters(t, map[string][]*RosterEntry{"cse160": {&ada}})
+
+	entries := []RosterEntry{{FirstName: "Ada L.", Email: "ada@ucsd.edu"}, {FirstName: "Bob", Email: "bob@ucsd.edu"}}
+	for _, course := range []string{"cse160", "cse260"} {
+		if _, _, _, err := importRoster(course, entries, true); !errors.Is(err, errRosterNotSaved) {
+			t.Errorf("%s: error = %v, want %v", course, err, errRosterNotSaved)
+		}
+	}
+	rostersMutex.Lock()
+	defer rostersMutex.Unlock()
+	want := map[string][]*RosterEntry{"cse160": {{ID: "r1", FirstName: "Ada", Email: "ada@ucsd.edu"}}}
+	if !reflect.DeepEqual(rosters, want) {
+		t.Errorf("failed imports changed the rosters: %+v", rosters)
+	}
+}
+
+func TestResolveSubmitters(t *testing.T) {
+	withTenants(t, map[string]*Tenant{
+		"open":   {Name: "open"},
+		"flag":   {Name: "flag", UnknownSubmitters: unknownFlag},
+		"reject": {Name: "reject", UnknownSubmitters: unknownReject},
+	})
+	ada := RosterEntry{ID: "r-ada", Email: "ada@ucsd.edu", SID: "A1"}
+	bob := RosterEntry{ID: "r-bob", Email: "bob@ucsd.edu", SID: "A2"}
+	withRosters(t, map[string][]*RosterEntry{"open": {&ada, &bob}, "flag": {&ada, &bob}, "reject": {&ada, &bob}})
+
+	onRoster := gradescope.User{Name: "Ada Lovelace", Email: "ADA@ucsd.edu"}
+	bySID := gradescope.User{Name: "Bob Builder", SID: "A2"}
+	stranger := gradescope.User{Name: "Eve Smith", Email: "eve@ucsd.edu"}
+	tests := []struct {
+		name        string
+		course      string
+		users       []gradescope.User
+		displayName string
+		want        []string
+		flag        string
+		wantErr     bool
+	}{
+		{"on roster", "reject", []gradescope.User{onRoster}, "", []string{"r-ada"}, "", false},
+		{"on roster by SID", "reject", []gradescope.User{bySID}, "", []string{"r-bob"}, "", false},
+		{"unknown student accepted", "open", []gradescope.User{stranger}, "", []string{"eve-smith"}, "", false},
+		{"unknown student flagged", "flag", []gradescope.User{stranger}, "", []string{"eve-smith"}, "not on roster", false},
+		{"unknown student rejected", "reject", []gradescope.User{stranger}, "", nil, "", true},
+		{"display name wins for the primary", "flag", []gradescope.User{stranger}, "Eve S", []string{"eve-s"}, "not on roster", false},
+		{"group on roster", "reject", []gradescope.User{onRoster, bySID}, "", []string{"r-ada", "r-bob"}, "", false},
+		{"group partner not on roster accepted", "open", []gradescope.User{onRoster, stranger}, "", []string{"r-ada", "eve-smith"}, "", false},
+		{"group partner not on roster flagged", "flag", []gradescope.User{onRoster, stranger}, "", []string{"r-ada", "eve-smith"}, "not on roster: eve@ucsd.edu", false},
+		{"group partner not on roster rejects the group", "reject", []gradescope.User{onRoster, stranger}, "", nil, "", true},
+		{"duplicate members", "reject", []gradescope.User{onRoster, {Name: "Ada", SID: "A1"}}, "", []string{"r-ada"}, "", false},
+		{"no metadata accepted", "open", nil, "Eve Smith", []string{"eve-smith"}, "", false},
+		{"no metadata flagged", "flag", nil, "Eve Smith", []string{"eve-smith"}, "no submission metadata", false},
+		{"no metadata rejected", "reject", nil, "Eve Smith", nil, "", true},
+	}
+	for _, tt := range tests {
+		got, flag, err := resolveSubmitters(tt.course, tt.users, tt.displayName)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) || flag != tt.flag {
+			t.Errorf("%s: %v %q, want %v %q", tt.name, got, flag, tt.want, tt.flag)
+		}
+	}
+}
+
+func TestRunnerMetadataHidesIdentities(t *testing.T) {
+	withRosters(t, map[string][]*RosterEntry{"cse160": {{ID: "r1a2b3c4", FirstName: "Ada", Email: "ada@ucsd.edu", SID: "A123"}}})
+	md := &gradescope.SubmissionMetadata{
+		ID: "42",
+		Users: []gradescope.User{
+			{Name: "Ada Lovelace", Email: "ADA@ucsd.edu", ID: "7", SID: "A123"},
+			{Name: "Bob Builder", Email: "bob@ucsd.edu", SID: "A999"},
+		},
+	}
+	md.Assignment.Title = "PA2"
+	data, err := runnerMetadata("cse160", md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, identity := range []string{"Ada", "ada@", "A123", `"7"`, "Bob", "bob@", "A999"} {
+		if strings.Contains(string(data), identity) {
+			t.Errorf("runner metadata contains %s: %s", identity, data)
+		}
+	}
+	var got gradescope.SubmissionMetadata
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Users) != 2 || got.Users[0].Name != "r1a2b3c4" || got.Users[1].Name != "unlisted-2" || got.Assignment.Title != "PA2" || got.ID != "42" {
+		t.Errorf("runner metadata %s", data)
+	}
+	if md.Users[0].Email != "ADA@ucsd.edu" {
+		t.Error("the job record's metadata was changed")
+	}
+}
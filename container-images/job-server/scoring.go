@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"greengrader/webserver/gradescope"
+)
+
+// ScoringPolicy is applied by the server to the runner's results, so grading
+// policy can change without rebuilding the runner image.
+type ScoringPolicy struct {
+	// Rules are matched against each test name in order; the first match wins.
+	Rules []ScoreRule `json:"rules,omitempty"`
+
+	// MaxScore caps the total score. Zero means no cap.
+	MaxScore float64 `json:"max_score,omitempty"`
+
+	// DueDate enables late penalties when set. Submissions later than
+	// DueDate+GracePeriod lose PenaltyPerDay (a fraction, e.g. 0.1) of their
+	// score for every started day, up to MaxPenalty (0 means up to everything).
+	DueDate       *time.Time `json:"due_date,omitempty"`
+	GracePeriod   Duration   `json:"grace_period,omitempty"` // e.g. "30m"
+	PenaltyPerDay float64    `json:"penalty_per_day,omitempty"`
+	MaxPenalty    float64    `json:"max_penalty,omitempty"`
+
+	// UseGradescopeDates takes the due date and submission time from the
+	// submission's Gradescope metadata, when it was sent, instead of
+	// DueDate and the time the submission reached the server.
+	UseGradescopeDates bool `json:"use_gradescope_dates,omitempty"`
+}
+
+// ScoreRule adjusts the tests whose name matches Pattern, a glob where '*'
+// matches any run of characters and '?' a single character.
+type ScoreRule struct {
+	Pattern string `json:"pattern,omitempty"`
+	// Points rescales the test to be worth this many points, keeping the
+	// fraction of the original max score it earned. Nil leaves it alone.
+	Points *float64 `json:"points,omitempty"`
+	// Visibility overrides the test's visibility, e.g. "after_due_date".
+	Visibility string `json:"visibility,omitempty"`
+}
+
+func (r *ScoreRule) matches(name string) bool {
+	return globMatch(r.Pattern, name)
+}
+
+// globMatch matches name against a glob where '*' matches any run of
+// characters, '/' included, and '?' a single character.
+func globMatch(pattern, name string) bool {
+	p, n := []rune(pattern), []rune(name)
+	pi, ni := 0, 0
+	star, mark := -1, 0 // last '*' seen and where in name it started matching
+	for ni < len(n) {
+		switch {
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ni
+			pi++
+		case pi < len(p) && (p[pi] == '?' || p[pi] == n[ni]):
+			pi++
+			ni++
+		case star >= 0:
+			// let the last '*' swallow one more character and retry
+			mark++
+			pi, ni = star+1, mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// Duration is a time.Duration written in JSON as a string such as "48h" or
+// "30m".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"48h\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", s, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// latePenalty returns the fraction of the score lost and the number of days late.
+func (p *ScoringPolicy) latePenalty(submitted time.Time) (float64, int) {
+	if p.DueDate == nil || p.PenaltyPerDay <= 0 {
+		return 0, 0
+	}
+	late := submitted.Sub(p.DueDate.Add(time.Duration(p.GracePeriod)))
+	if late <= 0 {
+		return 0, 0
+	}
+	days := int(math.Ceil(late.Hours() / 24))
+	penalty := float64(days) * p.PenaltyPerDay
+	limit := p.MaxPenalty
+	if limit <= 0 || limit > 1 {
+		limit = 1
+	}
+	return math.Min(penalty, limit), days
+}
+
+// applyScoring rewrites results.json according to the policy. A nil policy
+// leaves the results untouched. metadata may be nil.
+func applyScoring(p *ScoringPolicy, results []byte, submitted time.Time, metadata *gradescope.SubmissionMetadata) ([]byte, error) {
+	if p == nil {
+		return results, nil
+	}
+	if p.UseGradescopeDates && metadata != nil {
+		policy := *p
+		if due := metadata.Assignment.DueDate; !due.IsZero() {
+			policy.DueDate = &due
+		}
+		if !metadata.CreatedAt.IsZero() {
+			submitted = metadata.CreatedAt
+		}
+		p = &policy
+	}
+	res, err := parseRawResults(results)
+	if err != nil {
+		return nil, fmt.Errorf("parsing results for scoring: %w", err)
+	}
+
+	for i := range res.Tests {
+		t := &res.Tests[i]
+		for j := range p.Rules {
+			rule := &p.Rules[j]
+			if !rule.matches(t.Name) {
+				continue
+			}
+			// A test worth nothing without a status was skipped (see
+			// convertResults) and stays neutral.
+			if rule.Points != nil && (t.MaxScore > 0 || t.Status != "") {
+				earned := 0.0
+				if t.MaxScore > 0 {
+					earned = t.Score / t.MaxScore
+				} else if t.Status == gradescope.Passed {
+					earned = 1
+				}
+				t.MaxScore = *rule.Points
+				t.Score = earned * t.MaxScore
+			}
+			if rule.Visibility != "" {
+				t.Visibility = rule.Visibility
+			}
+			break
+		}
+	}
+
+	total := res.TotalScore()
+	if len(res.Tests) > 0 {
+		// the runner's own top-level score is stale once tests are reweighted
+		res.Score = nil
+		total = res.TotalScore()
+	}
+	if p.MaxScore > 0 && total > p.MaxScore {
+		total = p.MaxScore
+	}
+	if penalty, days := p.latePenalty(submitted); penalty > 0 {
+		if res.ExtraData == nil {
+			res.ExtraData = map[string]any{}
+		}
+		res.ExtraData["late_days"] = days
+		res.ExtraData["late_penalty"] = penalty
+		res.Output = strings.TrimLeft(fmt.Sprintf("%s\nLate penalty: %d day(s) late, -%g%%", res.Output, days, penalty*100), "\n")
+		total *= 1 - penalty
+	}
+	res.Score = &total
+
+	return res.marshal()
+}
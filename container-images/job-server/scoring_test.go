@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"greengrader/webserver/gradescope"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything/at/all", true},
+		{"vec*", "vector add", true},
+		{"vec*", "a vector", false},
+		{"*add", "vector add", true},
+		{"*PA2/Makefile", "student/PA2/Makefile", true},
+		{"*PA2/Makefile", "student/PA2/Makefile.bak", false},
+		{"test ?", "test 7", true},
+		{"test ?", "test 10", false},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXcYb", false},
+		{"a.c", "abc", false}, // no regexp semantics
+		{"[x]", "[x]", true},
+		{"*.cl", "vector_add_4.cl", true},
+		{"**x", "yyx", true},
+		{"ü?", "üß", true},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{`"30m"`, 30 * time.Minute, false},
+		{`"48h"`, 48 * time.Hour, false},
+		{`"1h30m"`, 90 * time.Minute, false},
+		{`3600000000000`, 0, true},
+		{`"two days"`, 0, true},
+		{`true`, 0, true},
+	}
+	for _, tt := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(tt.input), &d)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v, want error %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if err == nil && time.Duration(d) != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, want %v", tt.input, time.Duration(d), tt.want)
+		}
+	}
+	data, err := json.Marshal(ScoringPolicy{GracePeriod: Duration(90 * time.Minute)})
+	if err != nil || !strings.Contains(string(data), `"grace_period":"1h30m0s"`) {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+	data, _ = json.Marshal(ScoringPolicy{})
+	if strings.Contains(string(data), "grace_period") || strings.Contains(string(data), "due_date") {
+		t.Errorf("an unset grace period or due date was not omitted: %s", data)
+	}
+}
+
+func TestLatePenalty(t *testing.T) {
+	due := time.Date(2025, 5, 1, 23, 59, 0, 0, time.UTC)
+	p := ScoringPolicy{DueDate: &due, GracePeriod: Duration(time.Hour), PenaltyPerDay: 0.1, MaxPenalty: 0.25}
+	tests := []struct {
+		submitted time.Time
+		penalty   float64
+		days      int
+	}{
+		{due.Add(-time.Hour), 0, 0},
+		{due.Add(59 * time.Minute), 0, 0},
+		{due.Add(61 * time.Minute), 0.1, 1},
+		{due.Add(25*time.Hour + time.Minute), 0.2, 2},
+		{due.Add(10 * 24 * time.Hour), 0.25, 10},
+	}
+	for _, tt := range tests {
+		penalty, days := p.latePenalty(tt.submitted)
+		if days != tt.days || penalty < tt.penalty-1e-9 || penalty > tt.penalty+1e-9 {
+			t.Errorf("latePenalty(%v) = %g, %d, want %g, %d", tt.submitted.Sub(due), penalty, days, tt.penalty, tt.days)
+		}
+	}
+	if penalty, _ := (&ScoringPolicy{PenaltyPerDay: 0.1}).latePenalty(due); penalty != 0 {
+		t.Errorf("a policy without a due date charged %g", penalty)
+	}
+}
+
+func TestApplyScoring(t *testing.T) {
+	five, two := 5.0, 2.0
+	due := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	results := `{"score": 99, "output_format": "md", "test_name_format": "text", "n_time": 1.25, "tests": [
+		{"name": "part1 small", "score": 1, "max_score": 2, "name_format": "md", "extra_data": {"k": 1}, "hint": "x"},
+		{"name": "part1 big", "score": 0, "max_score": 0, "status": "passed"},
+		{"name": "part2", "score": 3, "max_score": 3},
+		{"name": "skipped", "score": 0, "max_score": 0}
+	]}`
+	tests := []struct {
+		name      string
+		policy    *ScoringPolicy
+		submitted time.Time
+		want      float64
+	}{
+		{"nil policy keeps the runner's score", nil, due, 99},
+		{"empty policy sums the tests", &ScoringPolicy{}, due, 4},
+		{"rules reweight", &ScoringPolicy{Rules: []ScoreRule{{Pattern: "part1*", Points: &five}, {Pattern: "*", Points: &two}}}, due, 2.5 + 5 + 2},
+		{"cap", &ScoringPolicy{MaxScore: 3}, due, 3},
+		{"late", &ScoringPolicy{DueDate: &due, PenaltyPerDay: 0.5}, due.Add(time.Hour), 2},
+	}
+	for _, tt := range tests {
+		data, err := applyScoring(tt.policy, []byte(results), tt.submitted, nil)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var res gradescope.Results
+		if err := json.Unmarshal(data, &res); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := res.TotalScore(); got != tt.want {
+			t.Errorf("%s: score %g, want %g", tt.name, got, tt.want)
+		}
+		if tt.policy == nil {
+			continue
+		}
+		// fields the policy does not touch survive the round trip, modelled or not
+		for _, s := range []string{`"output_format":"md"`, `"test_name_format":"text"`, `"name_format":"md"`, `"extra_data":{"k":1}`, `"n_time":1.25`, `"hint":"x"`} {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("%s: %s was dropped from %s", tt.name, s, data)
+			}
+		}
+		if res.Tests[3].MaxScore != 0 {
+			t.Errorf("%s: the skipped test became worth %g", tt.name, res.Tests[3].MaxScore)
+		}
+	}
+}
+
+func TestApplyScoringGradescopeDates(t *testing.T) {
+	due := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC)
+	p := &ScoringPolicy{DueDate: &due, PenaltyPerDay: 0.5, UseGradescopeDates: true}
+	md := &gradescope.SubmissionMetadata{CreatedAt: due.Add(-time.Hour)}
+	md.Assignment.DueDate = due
+	data, err := applyScoring(p, []byte(`{"score": 10}`), due.Add(time.Hour), md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"score":10`) {
+		t.Errorf("an on-time Gradescope submission was penalised: %s", data)
+	}
+	data, _ = applyScoring(p, []byte(`{"score": 10}`), due.Add(time.Hour), nil)
+	if !strings.Contains(string(data), `"score":5`) {
+		t.Errorf("without metadata the server's time should apply: %s", data)
+	}
+}
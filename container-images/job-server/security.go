@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SecurityProfile describes how tightly a runner pod is sandboxed.
+type SecurityProfile struct {
+	// RunAsUser/RunAsGroup run the runner as this non-root UID/GID;
+	// 0 keeps the image's user.
+	RunAsUser  int64
+	RunAsGroup int64
+
+	// ReadOnlyRootFilesystem makes the image read-only; WritableDirs get an
+	// emptyDir each, and HOME is set to HomeDir (one of them).
+	ReadOnlyRootFilesystem bool
+	WritableDirs           []string
+	HomeDir                string
+
+	DropAllCapabilities   bool
+	SeccompRuntimeDefault bool
+
+	// AutomountServiceAccountToken gives the runner API credentials; no
+	// built-in profile needs them.
+	AutomountServiceAccountToken bool
+}
+
+// defaultSecurityProfile is used for assignments that do not pick one.
+const defaultSecurityProfile = "restricted"
+
+// securityProfiles are the profiles assignments can select by name.
+var securityProfiles = map[string]*SecurityProfile{
+	// student code runs as an unprivileged user that can only write to $HOME and /tmp
+	"restricted": {
+		RunAsUser:              1000,
+		RunAsGroup:             1000,
+		ReadOnlyRootFilesystem: true,
+		WritableDirs:           []string{"/home/runner", "/tmp"},
+		HomeDir:                "/home/runner",
+		DropAllCapabilities:    true,
+		SeccompRuntimeDefault:  true,
+	},
+	// for images that must run as their own (possibly root) user and write
+	// anywhere; still without capabilities or API credentials
+	"image-user": {
+		DropAllCapabilities:   true,
+		SeccompRuntimeDefault: true,
+	},
+}
+
+func lookupSecurityProfile(name string) (*SecurityProfile, error) {
+	if name == "" {
+		name = defaultSecurityProfile
+	}
+	p, ok := securityProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown security profile %q", name)
+	}
+	return p, nil
+}
+
+// applySecurityProfile sandboxes the runner pod according to the profile.
+func applySecurityProfile(spec *corev1.PodSpec, p *SecurityProfile) {
+	automount := p.AutomountServiceAccountToken
+	spec.AutomountServiceAccountToken = &automount
+
+	podSecurity := &corev1.PodSecurityContext{}
+	if p.RunAsUser != 0 {
+		nonRoot := true
+		uid, gid := p.RunAsUser, p.RunAsGroup
+		podSecurity.RunAsNonRoot = &nonRoot
+		podSecurity.RunAsUser = &uid
+		if gid != 0 {
+			podSecurity.RunAsGroup = &gid
+			podSecurity.FSGroup = &gid
+		}
+	}
+	if p.SeccompRuntimeDefault {
+		podSecurity.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	}
+	spec.SecurityContext = podSecurity
+
+	runner := &spec.Containers[0]
+	noEscalation := false
+	readOnly := p.ReadOnlyRootFilesystem
+	runner.SecurityContext = &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &noEscalation,
+		ReadOnlyRootFilesystem:   &readOnly,
+	}
+	if p.DropAllCapabilities {
+		runner.SecurityContext.Capabilities = &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}
+	}
+
+	for i, dir := range p.WritableDirs {
+		volume := fmt.Sprintf("writable-%d", i)
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name:         volume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		runner.VolumeMounts = append(runner.VolumeMounts, corev1.VolumeMount{Name: volume, MountPath: path.Clean(dir)})
+	}
+	if p.HomeDir != "" {
+		runner.Env = append(runner.Env, corev1.EnvVar{Name: "HOME", Value: p.HomeDir})
+	}
+}
+
+// denyEgressPolicy blocks all outgoing traffic from the Job's pods, so a
+// submission cannot send hidden tests anywhere or reach the campus network.
+func denyEgressPolicy(jobName string) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: meta.ObjectMeta{Name: "deny-egress-" + jobName},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: meta.LabelSelector{MatchLabels: map[string]string{"job-name": jobName}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+		},
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,20 +10,13 @@ import (
 	"strings"
 	"time"
 
-	batchv1 "k8s.io/api/batch/v1" //Use `go get` to install packages
-	corev1 "k8s.io/api/core/v1"
-	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"greengrader/webserver/gradescope"
 
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes" //Use `go get` to install packages
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-type JobResponse struct {
-	Status string `json:"status"`
-	Error  string `json:"error,omitempty"`
-}
-
 func main() {
 	// Load kubeconfig from default or env var
 	var config *rest.Config
@@ -44,14 +36,32 @@ func main() {
 		}
 	}
 
+	if !datasetSecretSet() {
+		for _, a := range assignments {
+			if a.Dataset != nil {
+				log.Fatalf("Assignment %s generates datasets but DATASET_SECRET is not set", a.Name)
+			}
+		}
+	}
+
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		log.Fatalf("Failed to create Kubernetes client: %v", err)
 	}
+	go advertiseOpenCL(clientset, time.Minute)
+	go trackNodeReadiness(clientset, 30*time.Second)
+	ensurePriorityClasses(clientset)
+	provisionNamespaces(clientset)
+	go expireArchives()
+	go dispatch(clientset)
+
+	// Every endpoint except the health check below goes through authenticated
+	// and checks the caller's role on the job's course (auth.go).
+
 	/*
 	*  SUBMIT Request Handler
 	 */
-	http.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/submit", authenticated(func(w http.ResponseWriter, r *http.Request) {
 
 		//Check if request is POST
 		if r.Method != http.MethodPost {
@@ -65,15 +75,68 @@ func main() {
 			return
 		}
 
-		//Read metadata of request (Student name, assignment name, etc.)
-		student := strings.ToLower(r.FormValue("name"))
-		assignment := strings.ToLower(r.FormValue("image"))
-		if student == "" || assignment == "" {
-			http.Error(w, "Missing 'name' or 'image' field", http.StatusBadRequest)
+		//Read metadata of request (Student name, assignment name, Gradescope's submission_metadata.json)
+		assignment := sanitizeK8sName(r.FormValue("image"))
+		if assignment == "" {
+			http.Error(w, "Missing 'image' field", http.StatusBadRequest)
+			return
+		}
+		var submitters []gradescope.User
+		var metadata *gradescope.SubmissionMetadata
+		var metadataJSON []byte
+		if file, _, err := r.FormFile("metadata"); err == nil {
+			metadataJSON, err = io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				http.Error(w, "Failed to read metadata file", http.StatusInternalServerError)
+				return
+			}
+			metadata, err = gradescope.ParseMetadata(metadataJSON)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			submitters = metadata.Users
+		}
+		if len(submitters) == 0 && sanitizeK8sName(r.FormValue("name")) == "" {
+			http.Error(w, "Missing 'name' field or 'metadata' file", http.StatusBadRequest)
 			return
 		}
-		name := fmt.Sprintf("%s-%s-%d", student, assignment, time.Now().Unix())
-		startTime := time.Now() 
+
+		a := lookupAssignment(assignment)
+		if !allowed(w, r, permSubmit, a.tenant()) {
+			return
+		}
+		if a.Archived || lookupTenant(a.tenant()).Archived {
+			http.Error(w, "Assignment "+assignment+" is archived", http.StatusGone)
+			return
+		}
+
+		//Students submit at the highest priority; staff and bulk runs need an instructor token
+		priority := r.FormValue("priority")
+		if priority == "" {
+			priority = priorityStudent
+		}
+		if !validPriority(priority) {
+			http.Error(w, "Unknown priority "+priority, http.StatusBadRequest)
+			return
+		}
+		if priority != priorityStudent && !allowed(w, r, permManage, a.tenant()) {
+			return
+		}
+
+		//Match the submitter and any group partners against the course roster
+		students, rosterFlag, err := resolveSubmitters(a.tenant(), submitters, r.FormValue("name"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if len(students) == 0 {
+			http.Error(w, "Could not determine the submitter's name", http.StatusBadRequest)
+			return
+		}
+		startTime := time.Now()
+		name := newSubmissionID(assignment, startTime)
 
 		//Read file from form into buffer
 		file, _, err := r.FormFile("script")
@@ -88,134 +151,100 @@ func main() {
 			http.Error(w, "Failed to read script file", http.StatusInternalServerError)
 			return
 		}
+		rec := &JobRecord{
+			ID:         name,
+			Student:    students[0],
+			Students:   students,
+			Assignment: assignment,
+			Priority:   priority,
+			Tenant:     a.tenant(),
+			RosterFlag: rosterFlag,
+			Status:     statusQueued,
+			Submitted:  startTime,
+			Metadata:   metadata,
+		}
 
-		// Create a ConfigMap to hold the script
-		configMapName := "script-cm-" + name
-		_, err = clientset.CoreV1().ConfigMaps("default").Create(context.TODO(), &corev1.ConfigMap{
-			ObjectMeta: meta.ObjectMeta{
-				Name: configMapName,
-			},
-			BinaryData: map[string][]byte{
-				"archive.zip": zipData,
-			},
-		}, meta.CreateOptions{})
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create ConfigMap: %v", err), http.StatusInternalServerError)
-			return
-		}
-		jobClient := clientset.BatchV1().Jobs("default")
-
-		job_ttl := int32(120) //How long to keep job alive after completion (120 seconds)
-		// Create the Job that runs the script
-		job := &batchv1.Job{
-			ObjectMeta: meta.ObjectMeta{
-				Name: name,
-			},
-			Spec: batchv1.JobSpec{
-				TTLSecondsAfterFinished: &job_ttl,
-				Template: corev1.PodTemplateSpec{
-					Spec: corev1.PodSpec{
-						RestartPolicy: corev1.RestartPolicyNever,
-						Volumes: []corev1.Volume{
-							{
-								Name: "script-volume",
-								VolumeSource: corev1.VolumeSource{
-									ConfigMap: &corev1.ConfigMapVolumeSource{
-										LocalObjectReference: corev1.LocalObjectReference{
-											Name: configMapName,
-										},
-									},
-								},
-							},
-						},
-						Containers: []corev1.Container{
-							{
-								Name: "runner",
-								// Image: "arunanthivi/job-grader:python", //Python image for container
-								Image:           "rsankar12/opencl_cse160", //Rishab's OpenCL image for container
-								ImagePullPolicy: corev1.PullAlways,
-								Command: []string{
-  "sh", "-c",
-  // ① unzip silently
-  "unzip /scripts/archive.zip -d $HOME >/dev/null 2>&1 && " +
-  // ② locate the PA2 folder (first match) and cd into it, suppressing errors
-  "PA2DIR=$(find $HOME -type d -name PA2 | head -n1) && " +
-  "{ cd \"$PA2DIR\" 2>/dev/null || EXIT=1; } && " +
-  // ③ run make, capture output and exit‐code only if cd succeeded
-  "if [ \"$EXIT\" != \"1\" ]; then make -s run > /tmp/out 2>&1; EXIT=$?; fi; " +
-  // ④ emit *only* JSON, then exit 0
-  "if [ \"$EXIT\" != \"0\" ]; then echo '{\"score\":0}'; else cat /tmp/out; fi",
-},
-								VolumeMounts: []corev1.VolumeMount{
-									{
-										Name:      "script-volume",
-										MountPath: "/scripts",
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		}
-		_, err = jobClient.Create(context.TODO(), job, meta.CreateOptions{})
+		//Refuse broken or unsafe archives and failed pre-checks before they
+		//reach the cluster; the response body is the results.json Gradescope
+		//shows the student
+		if problems := validateArchive(zipData, a.Archive); len(problems) > 0 {
+			rejectSubmission(w, rec, invalidArchiveResults(problems), failureInvalidArchive, strings.Join(problems, " "))
+			return
+		}
+		errors, warnings := runPrechecks(a.Prechecks, zipData)
+		if len(errors) > 0 {
+			rejectSubmission(w, rec, precheckResults(errors, warnings), failurePrecheck, describePrechecks(errors))
+			return
+		}
+		rec.Warnings = warnings
+
+		//Keep the accepted archive for staff downloads, regrades and the result cache
+		rec.Archive, err = storeArchive(zipData)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create Job: %v", err), http.StatusInternalServerError)
-			return
-		}
-		defer clientset.CoreV1().ConfigMaps("default").Delete(context.TODO(), configMapName, meta.DeleteOptions{})
-		defer jobClient.Delete(context.TODO(), name, meta.DeleteOptions{})
-
-		//Poll for Job completion
-		// for {
-		// 	job, err := jobClient.Get(context.TODO(), name, meta.GetOptions{})
-		// 	if err != nil {
-		// 		http.Error(w, fmt.Sprintf("Failed to get job status: %v", err), http.StatusInternalServerError)
-		// 		return
-		// 	}
-
-		// 	if job.Status.Succeeded > 0 {
-		// 		break
-		// 	} else if job.Status.Failed > 0 {
-		// 		http.Error(w, "Job failed", http.StatusInternalServerError)
-		// 		return
-		// 	}
-
-		// 	time.Sleep(2 * time.Second)
-		// }
-
-		// Get the pod name associated with the job
-		// pods, err := clientset.CoreV1().Pods("default").List(context.TODO(), meta.ListOptions{
-		// 	LabelSelector: fmt.Sprintf("job-name=%s", name),
-		// })
-		// if err != nil || len(pods.Items) == 0 {
-		// 	http.Error(w, "Failed to list pods for job", http.StatusInternalServerError)
-		// 	return
-		// }
-
-		// podName := pods.Items[0].Name
-
-		// // Fetch logs from the pod
-		// logReq := clientset.CoreV1().Pods("default").GetLogs(podName, &corev1.PodLogOptions{})
-		// logStream, err := logReq.Stream(context.TODO())
-		// if err != nil {
-		// 	http.Error(w, "Failed to stream pod logs", http.StatusInternalServerError)
-		// 	return
-		// }
-		// defer logStream.Close()
-
-		// logs, err := io.ReadAll(logStream)
-		// if err != nil {
-		// 	http.Error(w, "Failed to read pod logs", http.StatusInternalServerError)
-		// 	return
-		// }
-
-		completion := time.Now()
-		updateLatency(startTime, completion)
+			log.Printf("Job %s: %v", name, err)
+			http.Error(w, "Failed to store the submission", http.StatusInternalServerError)
+			return
+		}
+
+		//An archive this assignment has already graded is answered from the cache
+		cached := false
+		if a.cachesResults() {
+			hit, err := lookupCachedResult(clientset, a, rec)
+			if err != nil {
+				log.Printf("Job %s: result cache: %v", name, err)
+			}
+			if hit != nil {
+				if err := serveCachedResult(a, rec, hit); err != nil {
+					log.Printf("Job %s: %v", name, err)
+				} else {
+					cached = true
+				}
+			}
+		}
+
+		putJob(rec)
+		if priority == priorityStudent {
+			supersede(rec)
+		}
+		if cached {
+			//Nothing to poll for: answer with the scored results.json, like a rejection
+			log.Printf("Job %s answered from the cache (results of %s)", name, rec.CachedFrom)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Location", "/status/"+name)
+			w.WriteHeader(http.StatusOK)
+			w.Write(rec.Results)
+			return
+		}
+		queue.push(&queuedJob{
+			id:         name,
+			assignment: a,
+			archive:    rec.Archive,
+			priority:   priority,
+			tenant:     a.tenant(),
+			enqueued:   startTime,
+		})
+
 		w.Header().Set("Content-Type", "application/json")
-		// w.Write(logs)
-		
-	})
+		w.WriteHeader(http.StatusAccepted) // the client polls /status/{job_id} for results
+		json.NewEncoder(w).Encode(JobResponse{
+			Status: "Job created, please poll /status/" + name + " for results",
+			JobID:  name,
+		})
+	}))
+
+	http.HandleFunc("/status/", authenticated(statusHandler))
+	http.HandleFunc("/jobs", authenticated(jobsHandler))
+	http.HandleFunc("/jobs/", authenticated(jobsHandler))
+	http.HandleFunc("/grades/", authenticated(gradesHandler))
+	http.HandleFunc("/metrics", authenticated(metricsHandler))
+	http.HandleFunc("/admin/namespaces", authenticated(namespacesHandler(clientset)))
+	http.HandleFunc("/admin/bundles/", authenticated(bundlesHandler(clientset)))
+	http.HandleFunc("/admin/tokens", authenticated(tokensHandler))
+	http.HandleFunc("/admin/rosters/", authenticated(rostersHandler))
+	http.HandleFunc("/admin/tokens/", authenticated(tokensHandler))
+	http.HandleFunc("/admin/regrades", authenticated(regradesHandler))
+	http.HandleFunc("/admin/regrades/", authenticated(regradesHandler))
+	registerConfigHandlers(clientset)
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Tenant is a course or workload class sharing the phone cluster.
+type Tenant struct {
+	ConfigMeta
+	Name string `json:"name,omitempty"`
+	// Weight is the tenant's share of the run slots relative to the other
+	// tenants with waiting work (default 1).
+	Weight float64 `json:"weight,omitempty"`
+	// MinSlots run slots are guaranteed: while the tenant runs fewer jobs than
+	// this, freed slots go to it before anyone else.
+	MinSlots int `json:"min_slots,omitempty"`
+
+	// Namespace, if set, is the course namespace the tenant's jobs run in.
+	// The server creates it with a ResourceQuota (Quota, resource name to
+	// quantity, e.g. "requests.cpu": "8" or "count/jobs.batch": "20") and a
+	// LimitRange giving containers DefaultResources. Tenants without one
+	// share the default namespace.
+	Namespace        string            `json:"namespace,omitempty"`
+	Quota            map[string]string `json:"quota,omitempty"`
+	DefaultResources *ResourceConfig   `json:"default_resources,omitempty"`
+
+	// UnknownSubmitters says what happens to submitters missing from the
+	// course roster: "accept" (default), "flag" or "reject" (see roster.go).
+	UnknownSubmitters string `json:"unknown_submitters,omitempty"`
+}
+
+// defaultTenantName is used for assignments that do not name a tenant.
+const defaultTenantName = "default"
+
+// tenants lists the cluster's tenants (courses). Assignments refer to them by
+// name. Like assignments, the table can be changed through the admin API.
+var tenants = map[string]*Tenant{
+	"cse160": {
+		Name: "cse160", Weight: 2, MinSlots: 4,
+		Namespace: "cse160",
+		Quota: map[string]string{
+			"requests.cpu":     "8",
+			"requests.memory":  "4Gi",
+			"limits.memory":    "8Gi",
+			"count/jobs.batch": "32",
+			"count/configmaps": "96",
+		},
+		DefaultResources: &ResourceConfig{CPURequest: "250m", CPULimit: "1", MemoryRequest: "128Mi", MemoryLimit: "512Mi"},
+	},
+	"fishsense": {Name: "fishsense", Weight: 1, MinSlots: 2},
+}
+
+func lookupTenant(name string) *Tenant {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	if t, ok := tenants[name]; ok {
+		return t
+	}
+	return &Tenant{Name: name, Weight: 1}
+}
+
+func (t *Tenant) weight() float64 {
+	if t.Weight > 0 {
+		return t.Weight
+	}
+	return 1
+}
+
+// tenant returns the name of the tenant the assignment's jobs are charged to.
+func (a *Assignment) tenant() string {
+	if a.Tenant != "" {
+		return a.Tenant
+	}
+	return defaultTenantName
+}
+
+// pickTenant chooses the tenant whose job runs next among those with a
+// ready (not parked) job at the highest waiting priority. Tenants below their
+// guaranteed minimum go first; otherwise deficit round-robin shares the slots
+// by weight: every time the round reaches a tenant its deficit grows by its
+// weight, and each dispatched job costs one, which is reported as charged.
+// Must be called with q.mu held.
+func (q *jobQueue) pickTenant() (tenant string, charged bool) {
+	now := time.Now()
+	top := -1
+	for _, j := range q.waiting {
+		if r := priorityRank(j.priority); r > top && j.ready(now) {
+			top = r
+		}
+	}
+	eligible := map[string]bool{}
+	for _, j := range q.waiting {
+		if priorityRank(j.priority) == top && j.ready(now) {
+			eligible[j.tenant] = true
+		}
+	}
+	if len(eligible) == 0 {
+		return "", false
+	}
+	order := make([]string, 0, len(eligible))
+	for t := range eligible {
+		order = append(order, t)
+	}
+	sort.Strings(order)
+
+	running := map[string]int{}
+	for _, j := range q.running {
+		running[j.tenant]++
+	}
+	short, shortBy := "", 0
+	for _, t := range order {
+		if n := lookupTenant(t).MinSlots - running[t]; n > shortBy {
+			short, shortBy = t, n
+		}
+	}
+	if short != "" {
+		return short, false
+	}
+
+	// tenants with nothing eligible lose their accumulated deficit, as in DRR
+	for t := range q.deficit {
+		if !eligible[t] {
+			delete(q.deficit, t)
+		}
+	}
+	i := sort.SearchStrings(order, q.current)
+	if i == len(order) || order[i] != q.current {
+		i %= len(order)
+		q.current = order[i]
+		q.deficit[q.current] += lookupTenant(q.current).weight()
+	}
+	for {
+		if q.deficit[q.current] >= 1 {
+			q.deficit[q.current]--
+			return q.current, true
+		}
+		i = (i + 1) % len(order)
+		q.current = order[i]
+		q.deficit[q.current] += lookupTenant(q.current).weight()
+	}
+}
+
+// tenantUsage is the per-tenant part of the metrics.
+type tenantUsage struct {
+	Dispatched  int     `json:"dispatched"`
+	Completed   int     `json:"completed"`
+	SlotSeconds float64 `json:"slot_seconds"` // time spent holding a run slot
+	WaitSeconds float64 `json:"wait_seconds"` // time spent queued before dispatch
+}
+
+func recordDispatch(j *queuedJob, now time.Time) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	u := state.usage(j.tenant)
+	u.Dispatched++
+	u.WaitSeconds += now.Sub(j.enqueued).Seconds()
+	save()
+}
+
+func recordRelease(j *queuedJob, completed bool, now time.Time) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	u := state.usage(j.tenant)
+	if completed {
+		u.Completed++
+	}
+	if !j.started.IsZero() {
+		u.SlotSeconds += now.Sub(j.started).Seconds()
+	}
+	save()
+}
+
+// tenantMetrics combines the persisted usage with the queue's current state.
+type tenantMetrics struct {
+	tenantUsage
+	Weight   float64 `json:"weight"`
+	MinSlots int     `json:"min_slots"`
+	Running  int     `json:"running"`
+	Waiting  int     `json:"waiting"`
+}
+
+func currentTenantMetrics() map[string]tenantMetrics {
+	out := map[string]tenantMetrics{}
+	entry := func(name string) tenantMetrics {
+		if m, ok := out[name]; ok {
+			return m
+		}
+		t := lookupTenant(name)
+		return tenantMetrics{Weight: t.weight(), MinSlots: t.MinSlots}
+	}
+	for _, t := range tenantSnapshot() {
+		out[t.Name] = entry(t.Name)
+	}
+
+	stateMutex.Lock()
+	for name, u := range state.Tenants {
+		m := entry(name)
+		m.tenantUsage = *u
+		out[name] = m
+	}
+	stateMutex.Unlock()
+
+	queue.mu.Lock()
+	for _, j := range queue.running {
+		m := entry(j.tenant)
+		m.Running++
+		out[j.tenant] = m
+	}
+	for _, j := range queue.waiting {
+		m := entry(j.tenant)
+		m.Waiting++
+		out[j.tenant] = m
+	}
+	queue.mu.Unlock()
+	return out
+}
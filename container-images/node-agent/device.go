@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DeviceStatus is what the agent knows about the phone it runs on.
+// Fields that could not be read are left nil.
+type DeviceStatus struct {
+	BatteryPercent *int
+	BatteryStatus  string // "Charging", "Discharging", "Full", "Not charging"
+	Charging       *bool
+	TemperatureC   *float64 // hottest thermal zone
+	Throttled      bool     // a cooling device is active or TemperatureC is over the throttle threshold
+	OpenCL         bool     // an OpenCL ICD or library was found
+}
+
+// Prober reads device state from a sysfs tree. Root is normally "/" (or the
+// host's root mounted into the pod); tests point it at a fake tree.
+type Prober struct {
+	Root string
+	// ThrottleTempC marks the phone as throttled above this temperature even
+	// if no cooling device reports activity. Zero disables the check.
+	ThrottleTempC float64
+	// OpenCLPaths are globs (relative to Root) of OpenCL ICD files or libraries.
+	OpenCLPaths []string
+}
+
+var defaultOpenCLPaths = []string{
+	"etc/OpenCL/vendors/*.icd",
+	"vendor/lib64/libOpenCL.so",
+	"system/vendor/lib64/libOpenCL.so",
+	"usr/lib/libOpenCL.so*",
+	"usr/lib/*/libOpenCL.so*",
+}
+
+func (p *Prober) path(rel string) string {
+	return filepath.Join(p.Root, rel)
+}
+
+// Probe reads the current device status. Missing files are not errors: a
+// phone without a battery driver just reports no battery.
+func (p *Prober) Probe() DeviceStatus {
+	var st DeviceStatus
+	p.readBattery(&st)
+	p.readThermal(&st)
+	st.OpenCL = p.hasOpenCL()
+	return st
+}
+
+func (p *Prober) readBattery(st *DeviceStatus) {
+	supplies, _ := filepath.Glob(p.path("sys/class/power_supply/*"))
+	for _, dir := range supplies {
+		if readString(filepath.Join(dir, "type")) != "Battery" {
+			continue
+		}
+		if n, ok := readInt(filepath.Join(dir, "capacity")); ok {
+			pct := int(n)
+			st.BatteryPercent = &pct
+		}
+		if s := readString(filepath.Join(dir, "status")); s != "" {
+			st.BatteryStatus = s
+			// "Full" is only reported while plugged in, so it counts as charging.
+			charging := s == "Charging" || s == "Full"
+			st.Charging = &charging
+		}
+		return
+	}
+}
+
+func (p *Prober) readThermal(st *DeviceStatus) {
+	zones, _ := filepath.Glob(p.path("sys/class/thermal/thermal_zone*"))
+	for _, dir := range zones {
+		milli, ok := readInt(filepath.Join(dir, "temp"))
+		if !ok {
+			continue
+		}
+		c := float64(milli) / 1000
+		if st.TemperatureC == nil || c > *st.TemperatureC {
+			st.TemperatureC = &c
+		}
+	}
+
+	devices, _ := filepath.Glob(p.path("sys/class/thermal/cooling_device*"))
+	for _, dir := range devices {
+		if n, ok := readInt(filepath.Join(dir, "cur_state")); ok && n > 0 {
+			st.Throttled = true
+		}
+	}
+	if p.ThrottleTempC > 0 && st.TemperatureC != nil && *st.TemperatureC >= p.ThrottleTempC {
+		st.Throttled = true
+	}
+}
+
+func (p *Prober) hasOpenCL() bool {
+	paths := p.OpenCLPaths
+	if len(paths) == 0 {
+		paths = defaultOpenCLPaths
+	}
+	for _, pattern := range paths {
+		if matches, _ := filepath.Glob(p.path(pattern)); len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func readString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readInt(path string) (int64, bool) {
+	n, err := strconv.ParseInt(readString(path), 10, 64)
+	return n, err == nil
+}
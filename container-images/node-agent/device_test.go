@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree creates files (path relative to root -> contents) under a new
+// temporary root.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for rel, contents := range files {
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string
+		throttleTempC float64
+		percent       int // -1 for unknown
+		status        string
+		charging      string // "true", "false" or "" for unknown
+		tempC         float64
+		throttled     bool
+		openCL        bool
+	}{
+		{
+			name:     "empty tree",
+			files:    map[string]string{},
+			percent:  -1,
+			tempC:    -1,
+			charging: "",
+		},
+		{
+			name: "discharging battery next to a USB supply",
+			files: map[string]string{
+				"sys/class/power_supply/usb/type":         "USB\n",
+				"sys/class/power_supply/usb/status":       "Charging\n",
+				"sys/class/power_supply/battery/type":     "Battery\n",
+				"sys/class/power_supply/battery/capacity": "57\n",
+				"sys/class/power_supply/battery/status":   "Discharging\n",
+			},
+			percent:  57,
+			status:   "Discharging",
+			charging: "false",
+			tempC:    -1,
+		},
+		{
+			name: "full battery counts as charging",
+			files: map[string]string{
+				"sys/class/power_supply/battery/type":     "Battery",
+				"sys/class/power_supply/battery/capacity": "100",
+				"sys/class/power_supply/battery/status":   "Full",
+			},
+			percent:  100,
+			status:   "Full",
+			charging: "true",
+			tempC:    -1,
+		},
+		{
+			name: "hottest zone and an active cooling device",
+			files: map[string]string{
+				"sys/class/thermal/thermal_zone0/temp":        "41000\n",
+				"sys/class/thermal/thermal_zone1/temp":        "52500\n",
+				"sys/class/thermal/thermal_zone2/temp":        "garbage\n",
+				"sys/class/thermal/cooling_device0/cur_state": "0\n",
+				"sys/class/thermal/cooling_device1/cur_state": "2\n",
+			},
+			percent:   -1,
+			tempC:     52.5,
+			throttled: true,
+		},
+		{
+			name: "over the throttle temperature",
+			files: map[string]string{
+				"sys/class/thermal/thermal_zone0/temp":        "71000",
+				"sys/class/thermal/cooling_device0/cur_state": "0",
+			},
+			throttleTempC: 70,
+			percent:       -1,
+			tempC:         71,
+			throttled:     true,
+		},
+		{
+			name: "under the throttle temperature",
+			files: map[string]string{
+				"sys/class/thermal/thermal_zone0/temp": "69000",
+			},
+			throttleTempC: 70,
+			percent:       -1,
+			tempC:         69,
+		},
+		{
+			name:    "OpenCL ICD",
+			files:   map[string]string{"etc/OpenCL/vendors/mali.icd": "libmali.so\n"},
+			percent: -1,
+			tempC:   -1,
+			openCL:  true,
+		},
+		{
+			name:    "vendor OpenCL library",
+			files:   map[string]string{"vendor/lib64/libOpenCL.so": ""},
+			percent: -1,
+			tempC:   -1,
+			openCL:  true,
+		},
+	}
+	for _, tt := range tests {
+		p := &Prober{Root: writeTree(t, tt.files), ThrottleTempC: tt.throttleTempC}
+		st := p.Probe()
+
+		percent := -1
+		if st.BatteryPercent != nil {
+			percent = *st.BatteryPercent
+		}
+		charging := ""
+		if st.Charging != nil {
+			charging = map[bool]string{true: "true", false: "false"}[*st.Charging]
+		}
+		tempC := -1.0
+		if st.TemperatureC != nil {
+			tempC = *st.TemperatureC
+		}
+		if percent != tt.percent || st.BatteryStatus != tt.status || charging != tt.charging ||
+			tempC != tt.tempC || st.Throttled != tt.throttled || st.OpenCL != tt.openCL {
+			t.Errorf("%s: got %+v, want percent=%d status=%q charging=%q temp=%g throttled=%v opencl=%v",
+				tt.name, describe(st), tt.percent, tt.status, tt.charging, tt.tempC, tt.throttled, tt.openCL)
+		}
+	}
+}
+
+func TestProbeCustomOpenCLPaths(t *testing.T) {
+	root := writeTree(t, map[string]string{"opt/cl/libOpenCL.so.1": ""})
+	p := &Prober{Root: root}
+	if p.Probe().OpenCL {
+		t.Error("found OpenCL outside the default paths")
+	}
+	p.OpenCLPaths = []string{"opt/cl/libOpenCL.so*"}
+	if !p.Probe().OpenCL {
+		t.Error("did not find OpenCL in a configured path")
+	}
+}
@@ -0,0 +1,88 @@
+// node-agent runs on every phone (as a DaemonSet) and publishes battery,
+// temperature, thermal throttling and OpenCL availability as node labels and
+// annotations so the scheduler and the job server can avoid unhealthy phones.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func main() {
+	root := flag.String("root", "/", "root of the host filesystem (sysfs is read from <root>/sys)")
+	interval := flag.Duration("interval", 30*time.Second, "how often to publish device status")
+	lowBattery := flag.Int("low-battery", 20, "battery percentage at or below which the node is labelled battery-low")
+	throttleTemp := flag.Float64("throttle-temp", 0, "temperature (C) above which the node counts as throttled; 0 relies on cooling devices only")
+	openCLPaths := flag.String("opencl-paths", "", "comma separated globs (relative to -root) that indicate an OpenCL ICD; defaults to the usual ICD and libOpenCL locations")
+	once := flag.Bool("once", false, "probe and print the status once without publishing")
+	flag.Parse()
+
+	prober := &Prober{Root: *root, ThrottleTempC: *throttleTemp}
+	if *openCLPaths != "" {
+		prober.OpenCLPaths = strings.Split(*openCLPaths, ",")
+	}
+
+	if *once {
+		fmt.Printf("%+v\n", describe(prober.Probe()))
+		return
+	}
+
+	nodeName := os.Getenv("NODE_NAME")
+	if nodeName == "" {
+		log.Fatal("NODE_NAME must be set (use the downward API spec.nodeName)")
+	}
+
+	// Load kubeconfig from env var or in-cluster config
+	var config *rest.Config
+	var err error
+	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		log.Fatalf("Failed to load kube config: %v", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Fatalf("Failed to create Kubernetes client: %v", err)
+	}
+
+	publisher := &Publisher{Client: clientset, NodeName: nodeName, LowBatteryPercent: *lowBattery}
+	log.Printf("Publishing device status for node %s every %s", nodeName, *interval)
+	for {
+		st := prober.Probe()
+		if err := publisher.Publish(context.Background(), st); err != nil {
+			log.Printf("Failed to publish device status: %v", err)
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// describe flattens the pointer fields for printing.
+func describe(st DeviceStatus) map[string]any {
+	out := map[string]any{
+		"battery_status": st.BatteryStatus,
+		"throttled":      st.Throttled,
+		"opencl":         st.OpenCL,
+	}
+	if st.BatteryPercent != nil {
+		out["battery_percent"] = *st.BatteryPercent
+	}
+	if st.Charging != nil {
+		out["charging"] = *st.Charging
+	}
+	if st.TemperatureC != nil {
+		out["temperature_c"] = *st.TemperatureC
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Labels are coarse values the scheduler and job server can select on;
+// annotations carry the exact readings.
+const (
+	labelPrefix = "greengrader.ucsd.edu/"
+
+	labelOpenCL     = labelPrefix + "opencl"
+	labelThrottled  = labelPrefix + "thermal-throttled"
+	labelBatteryLow = labelPrefix + "battery-low"
+	labelCharging   = labelPrefix + "charging"
+
+	annotationBatteryPercent = labelPrefix + "battery-percent"
+	annotationBatteryStatus  = labelPrefix + "battery-status"
+	annotationTemperature    = labelPrefix + "temperature-c"
+	annotationUpdated        = labelPrefix + "device-updated-at"
+)
+
+// Publisher writes a DeviceStatus onto a node.
+type Publisher struct {
+	Client   kubernetes.Interface
+	NodeName string
+	// LowBatteryPercent sets the battery-low label at or below this level.
+	LowBatteryPercent int
+}
+
+// nodeMetadata returns the labels and annotations for st. Readings that are
+// unknown map to nil so the merge patch removes any stale value.
+func (p *Publisher) nodeMetadata(st DeviceStatus, now time.Time) (labels, annotations map[string]any) {
+	labels = map[string]any{
+		labelOpenCL:     strconv.FormatBool(st.OpenCL),
+		labelThrottled:  strconv.FormatBool(st.Throttled),
+		labelBatteryLow: nil,
+		labelCharging:   nil,
+	}
+	annotations = map[string]any{
+		annotationBatteryPercent: nil,
+		annotationBatteryStatus:  nil,
+		annotationTemperature:    nil,
+		annotationUpdated:        now.UTC().Format(time.RFC3339),
+	}
+	if st.BatteryPercent != nil {
+		labels[labelBatteryLow] = strconv.FormatBool(*st.BatteryPercent <= p.LowBatteryPercent)
+		annotations[annotationBatteryPercent] = strconv.Itoa(*st.BatteryPercent)
+	}
+	if st.Charging != nil {
+		labels[labelCharging] = strconv.FormatBool(*st.Charging)
+	}
+	if st.BatteryStatus != "" {
+		annotations[annotationBatteryStatus] = st.BatteryStatus
+	}
+	if st.TemperatureC != nil {
+		annotations[annotationTemperature] = strconv.FormatFloat(*st.TemperatureC, 'f', 1, 64)
+	}
+	return labels, annotations
+}
+
+// Publish patches the node's labels and annotations with st.
+func (p *Publisher) Publish(ctx context.Context, st DeviceStatus) error {
+	labels, annotations := p.nodeMetadata(st, time.Now())
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"labels":      labels,
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = p.Client.CoreV1().Nodes().Patch(ctx, p.NodeName, types.MergePatchType, patch, meta.PatchOptions{})
+	return err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPublish(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"sys/class/power_supply/battery/type":     "Battery",
+		"sys/class/power_supply/battery/capacity": "15",
+		"sys/class/power_supply/battery/status":   "Charging",
+		"sys/class/thermal/thermal_zone0/temp":    "38250",
+		"etc/OpenCL/vendors/mali.icd":             "libmali.so",
+	})
+	client := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: meta.ObjectMeta{
+		Name:        "phone-1",
+		Labels:      map[string]string{"kubernetes.io/hostname": "phone-1"},
+		Annotations: map[string]string{"other": "kept"},
+	}})
+	pub := &Publisher{Client: client, NodeName: "phone-1", LowBatteryPercent: 20}
+	ctx := context.Background()
+
+	if err := pub.Publish(ctx, (&Prober{Root: root}).Probe()); err != nil {
+		t.Fatal(err)
+	}
+	node, err := client.CoreV1().Nodes().Get(ctx, "phone-1", meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLabels := map[string]string{
+		"kubernetes.io/hostname": "phone-1",
+		labelOpenCL:              "true",
+		labelThrottled:           "false",
+		labelBatteryLow:          "true",
+		labelCharging:            "true",
+	}
+	for k, v := range wantLabels {
+		if node.Labels[k] != v {
+			t.Errorf("label %s = %q, want %q", k, node.Labels[k], v)
+		}
+	}
+	wantAnnotations := map[string]string{
+		"other":                  "kept",
+		annotationBatteryPercent: "15",
+		annotationBatteryStatus:  "Charging",
+		annotationTemperature:    "38.2",
+	}
+	for k, v := range wantAnnotations {
+		if node.Annotations[k] != v {
+			t.Errorf("annotation %s = %q, want %q", k, node.Annotations[k], v)
+		}
+	}
+	if node.Annotations[annotationUpdated] == "" {
+		t.Errorf("annotation %s is missing", annotationUpdated)
+	}
+
+	// Readings that disappear are removed rather than left stale.
+	if err := pub.Publish(ctx, (&Prober{Root: t.TempDir()}).Probe()); err != nil {
+		t.Fatal(err)
+	}
+	node, err = client.CoreV1().Nodes().Get(ctx, "phone-1", meta.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{labelBatteryLow, labelCharging} {
+		if v, ok := node.Labels[k]; ok {
+			t.Errorf("stale label %s = %q was kept", k, v)
+		}
+	}
+	for _, k := range []string{annotationBatteryPercent, annotationBatteryStatus, annotationTemperature} {
+		if v, ok := node.Annotations[k]; ok {
+			t.Errorf("stale annotation %s = %q was kept", k, v)
+		}
+	}
+	if node.Labels[labelOpenCL] != "false" || node.Annotations["other"] != "kept" {
+		t.Errorf("unexpected node metadata after the second publish: %v %v", node.Labels, node.Annotations)
+	}
+}
+
+func TestPublishMissingNode(t *testing.T) {
+	pub := &Publisher{Client: fake.NewSimpleClientset(), NodeName: "gone"}
+	if err := pub.Publish(context.Background(), DeviceStatus{}); err == nil {
+		t.Error("publishing to a missing node succeeded")
+	}
+}
+
+func TestBatteryLowThreshold(t *testing.T) {
+	pub := &Publisher{LowBatteryPercent: 20}
+	for percent, want := range map[int]string{19: "true", 20: "true", 21: "false"} {
+		labels, _ := pub.nodeMetadata(DeviceStatus{BatteryPercent: &percent}, meta.Now().Time)
+		if labels[labelBatteryLow] != want {
+			t.Errorf("battery at %d%%: battery-low = %v, want %s", percent, labels[labelBatteryLow], want)
+		}
+	}
+}